@@ -0,0 +1,19 @@
+package main
+
+import (
+	"time"
+
+	"example.com/chirpy/internal/database"
+)
+
+// accountRestriction returns why a user may not sign in or change anything,
+// or "" if they may.
+func accountRestriction(dbUser database.User) string {
+	if dbUser.BannedAt.Valid {
+		return "Account is banned"
+	}
+	if dbUser.SuspendedUntil.Valid && dbUser.SuspendedUntil.Time.After(time.Now()) {
+		return "Account is suspended"
+	}
+	return ""
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const defaultAdminUserPageSize int = 50
+const maxAdminUserPageSize int = 100
+
+// adminUser is the view of a user's account that moderators and admins get.
+type adminUser struct {
+	ID              uuid.UUID  `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Email           string     `json:"email"`
+	Handle          string     `json:"handle"`
+	DisplayName     string     `json:"display_name"`
+	Role            string     `json:"role"`
+	IsChirpyRed     bool       `json:"is_chirpy_red"`
+	IsEmailVerified bool       `json:"is_email_verified"`
+	LastLoginAt     *time.Time `json:"last_login_at"`
+	SuspendedUntil  *time.Time `json:"suspended_until"`
+	BannedAt        *time.Time `json:"banned_at"`
+}
+
+func adminUserFromDatabase(dbUser database.User) adminUser {
+	result := adminUser{
+		ID:              dbUser.ID,
+		CreatedAt:       dbUser.CreatedAt,
+		Email:           dbUser.Email,
+		Handle:          dbUser.Handle.String,
+		DisplayName:     dbUser.DisplayName,
+		Role:            dbUser.Role,
+		IsChirpyRed:     dbUser.IsChirpyRed,
+		IsEmailVerified: dbUser.EmailVerifiedAt.Valid,
+	}
+	if dbUser.LastLoginAt.Valid {
+		result.LastLoginAt = &dbUser.LastLoginAt.Time
+	}
+	if dbUser.SuspendedUntil.Valid && dbUser.SuspendedUntil.Time.After(time.Now()) {
+		result.SuspendedUntil = &dbUser.SuspendedUntil.Time
+	}
+	if dbUser.BannedAt.Valid {
+		result.BannedAt = &dbUser.BannedAt.Time
+	}
+	return result
+}
+
+// banUser bans a user until they are unbanned and revokes their refresh
+// tokens and personal access tokens.
+func banUser(ctx context.Context, q *database.Queries, userId uuid.UUID) error {
+	if err := q.BanUser(ctx, userId); err != nil {
+		return err
+	}
+	return revokeAllTokens(ctx, q, userId)
+}
+
+// handlerAdminGetUsers lists accounts, newest first, optionally only those
+// whose email or handle contains q. Older pages are fetched by passing the
+// ID of the last user received as before.
+func (cfg *apiConfig) handlerAdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Users      []adminUser `json:"users"`
+		NextBefore *uuid.UUID  `json:"next_before"`
+	}
+
+	limit := defaultAdminUserPageSize
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(parsed, maxAdminUserPageSize)
+	}
+
+	params := database.GetUsersForAdminParams{
+		MaxResults: int32(limit),
+	}
+	if query := strings.TrimSpace(r.URL.Query().Get("q")); query != "" {
+		params.Pattern = sql.NullString{String: escapeLike(strings.TrimPrefix(query, "@")), Valid: true}
+	}
+	if beforeParam := r.URL.Query().Get("before"); beforeParam != "" {
+		beforeId, err := uuid.Parse(beforeParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid before cursor")
+			return
+		}
+		before, err := cfg.dbQueries.GetUserByID(r.Context(), beforeId)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid before cursor")
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to fetch user: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: before.CreatedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: before.ID, Valid: true}
+	}
+
+	dbUsers, err := cfg.dbQueries.GetUsersForAdmin(r.Context(), params)
+	if err != nil {
+		log.Printf("Unable to fetch users: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	resp := response{Users: []adminUser{}}
+	for _, dbUser := range dbUsers {
+		resp.Users = append(resp.Users, adminUserFromDatabase(dbUser))
+	}
+	if len(dbUsers) == limit {
+		resp.NextBefore = &dbUsers[len(dbUsers)-1].ID
+	}
+
+	respondWithJson(w, http.StatusOK, resp)
+}
+
+// handlerAdminGetUser returns an account together with its chirp count and
+// the moderation decisions taken against it, newest first.
+func (cfg *apiConfig) handlerAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		adminUser
+		ChirpCount int64              `json:"chirp_count"`
+		Actions    []moderationAction `json:"moderation_actions"`
+	}
+
+	userId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	chirpCount, err := cfg.dbQueries.CountChirpsByUser(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to count chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	dbActions, err := cfg.dbQueries.GetModerationActionsForUser(r.Context(), uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		log.Printf("Unable to fetch moderation actions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	resp := response{
+		adminUser:  adminUserFromDatabase(dbUser),
+		ChirpCount: chirpCount,
+		Actions:    []moderationAction{},
+	}
+	for _, dbAction := range dbActions {
+		resp.Actions = append(resp.Actions, moderationActionFromDatabase(dbAction))
+	}
+
+	respondWithJson(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerAdminSuspendUser(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateUser(w, r, moderationSuspendUser)
+}
+
+func (cfg *apiConfig) handlerAdminBanUser(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateUser(w, r, moderationBanUser)
+}
+
+// handlerAdminUnbanUser lifts a ban as well as a suspension.
+func (cfg *apiConfig) handlerAdminUnbanUser(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateUser(w, r, moderationUnbanUser)
+}
+
+// moderateUser applies action to the user in the path and records it.
+// Moderators and admins can only act on users whose role is below their own.
+func (cfg *apiConfig) moderateUser(w http.ResponseWriter, r *http.Request, action string) {
+	type parameters struct {
+		Reason        string `json:"reason"`
+		DurationHours int    `json:"duration_hours"`
+	}
+
+	caller := principalFromContext(r.Context())
+
+	userId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(params.Reason) == "" {
+		respondWithError(w, http.StatusBadRequest, "A reason is required")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	dbUser, err := qtx.GetUserByID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if auth.HasRole(dbUser.Role, caller.Role) {
+		respondWithError(w, http.StatusForbidden, "You cannot moderate this user")
+		return
+	}
+
+	dbAction := database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: caller.UserID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: dbUser.ID, Valid: true},
+		Action:       action,
+		Reason:       params.Reason,
+	}
+
+	switch action {
+	case moderationSuspendUser:
+		if params.DurationHours < 1 || params.DurationHours > maxSuspensionHours {
+			respondWithError(w, http.StatusBadRequest, "Invalid suspension duration")
+			return
+		}
+		if dbUser.BannedAt.Valid {
+			respondWithError(w, http.StatusConflict, "User is banned")
+			return
+		}
+		suspendedUntil := time.Now().UTC().Add(time.Duration(params.DurationHours) * time.Hour)
+		err = suspendUser(r.Context(), qtx, dbUser.ID, suspendedUntil)
+		dbAction.SuspendedUntil = sql.NullTime{Time: suspendedUntil, Valid: true}
+	case moderationBanUser:
+		if dbUser.BannedAt.Valid {
+			respondWithError(w, http.StatusConflict, "User is already banned")
+			return
+		}
+		err = banUser(r.Context(), qtx, dbUser.ID)
+	case moderationUnbanUser:
+		if accountRestriction(dbUser) == "" {
+			respondWithError(w, http.StatusConflict, "User is not suspended or banned")
+			return
+		}
+		err = qtx.UnbanUser(r.Context(), dbUser.ID)
+	}
+	if err != nil {
+		log.Printf("Unable to %s: %s", action, err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if _, err := qtx.CreateModerationAction(r.Context(), dbAction); err != nil {
+		log.Printf("Unable to record moderation action: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	dbUser, err = qtx.GetUserByID(r.Context(), dbUser.ID)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit moderation action: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, adminUserFromDatabase(dbUser))
+}
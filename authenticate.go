@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"example.com/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// Kinds of bearer tokens a request can be authenticated with.
+const (
+	tokenTypeAccess   string = "access_token"
+	tokenTypePersonal string = "personal_access_token"
+)
+
+// principal is who a request is made by, as established from its bearer
+// token.
+type principal struct {
+	UserID uuid.UUID
+	Role   string
+	// TokenType is tokenTypeAccess or tokenTypePersonal.
+	TokenType string
+	// SessionID is set for access tokens issued from a session.
+	SessionID uuid.UUID
+	// ClientID is set for access tokens issued to a third-party app.
+	ClientID uuid.UUID
+	// ExpiresAt is set for access tokens.
+	ExpiresAt time.Time
+	// Scopes limit what tokens of third-party apps and personal access
+	// tokens allow.
+	Scopes []string
+}
+
+// firstParty reports whether the principal signed in to one of Chirpy's
+// own clients, and may therefore do anything the user may.
+func (p principal) firstParty() bool {
+	return p.TokenType == tokenTypeAccess && p.ClientID == uuid.Nil
+}
+
+// hasScope reports whether the principal's token allows what scope stands
+// for.
+func (p principal) hasScope(scope string) bool {
+	return p.firstParty() || slices.Contains(p.Scopes, scope)
+}
+
+type principalContextKey struct{}
+
+// principalFromContext returns the principal of a request that passed
+// authenticated or requireScope.
+func principalFromContext(ctx context.Context) principal {
+	caller, _ := ctx.Value(principalContextKey{}).(principal)
+	return caller
+}
+
+// authenticated only passes requests on to next when they carry a valid
+// token of one of Chirpy's own clients, and stores its principal in the
+// request context. Tokens of third-party apps and personal access tokens
+// are refused.
+func (cfg *apiConfig) authenticated(next http.Handler) http.Handler {
+	return cfg.requireScope("", next)
+}
+
+// requireScope is like authenticated, but also passes on requests with
+// tokens of third-party apps and personal access tokens that were granted
+// scope. Write requests of suspended and banned users are refused: their
+// refresh tokens are revoked when they are restricted, but access tokens
+// stay valid until they expire.
+func (cfg *apiConfig) requireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, err := cfg.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy"`)
+			respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+
+		if !caller.hasScope(scope) {
+			if scope == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy", error="insufficient_scope"`)
+				respondWithError(w, http.StatusForbidden, "Token cannot be used for this request")
+				return
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="chirpy", error="insufficient_scope", scope="%s"`, scope))
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("Token lacks the %s scope", scope))
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions {
+			dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), caller.UserID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Unable to fetch user: %s", err)
+				respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				return
+			}
+			if err == nil {
+				if restriction := accountRestriction(dbUser); restriction != "" {
+					respondWithError(w, http.StatusForbidden, restriction)
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, caller)))
+	})
+}
+
+// authenticate establishes the principal of r from its bearer token, which
+// is either an access token or a personal access token.
+func (cfg *apiConfig) authenticate(r *http.Request) (principal, error) {
+	bearer, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return principal{}, err
+	}
+	return cfg.authenticateToken(r, bearer)
+}
+
+// authenticateToken establishes the principal of token, which is either an
+// access token or a personal access token, for a request r.
+func (cfg *apiConfig) authenticateToken(r *http.Request, token string) (principal, error) {
+	if auth.IsPersonalAccessToken(token) {
+		return cfg.authenticatePersonalAccessToken(r, token)
+	}
+
+	claims, err := auth.ParseJWT(token, cfg.jwtKeys)
+	if err != nil {
+		return principal{}, err
+	}
+	return principal{
+		UserID:    claims.UserID,
+		Role:      claims.Role,
+		TokenType: tokenTypeAccess,
+		SessionID: claims.SessionID,
+		ClientID:  claims.ClientID,
+		Scopes:    claims.Scopes,
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
+}
+
+// authenticatePersonalAccessToken looks token up and records that it was
+// used. Personal access tokens never carry more than the user role, so
+// they cannot be used for moderation.
+func (cfg *apiConfig) authenticatePersonalAccessToken(r *http.Request, token string) (principal, error) {
+	dbToken, err := cfg.dbQueries.GetPersonalAccessToken(r.Context(), auth.HashToken(token))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Unable to fetch personal access token: %s", err)
+		}
+		return principal{}, errors.New("Unknown personal access token")
+	}
+	if !auth.CheckTokenHash(token, dbToken.TokenHash) || dbToken.RevokedAt.Valid {
+		return principal{}, errors.New("Personal access token is revoked")
+	}
+	if dbToken.ExpiresAt.Valid && dbToken.ExpiresAt.Time.Before(time.Now()) {
+		return principal{}, errors.New("Personal access token is expired")
+	}
+
+	// Unlike access tokens, personal access tokens do not expire soon after
+	// their user is suspended or banned.
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), dbToken.UserID)
+	if err != nil {
+		return principal{}, err
+	}
+	if restriction := accountRestriction(dbUser); restriction != "" {
+		return principal{}, errors.New(restriction)
+	}
+
+	if err := cfg.dbQueries.UpdatePersonalAccessTokenLastUsed(r.Context(), dbToken.ID); err != nil {
+		log.Printf("Unable to record personal access token use: %s", err)
+	}
+
+	return principal{
+		UserID:    dbToken.UserID,
+		Role:      auth.RoleUser,
+		TokenType: tokenTypePersonal,
+		Scopes:    dbToken.Scopes,
+	}, nil
+}
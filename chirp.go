@@ -4,15 +4,18 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
-	"example.com/chirpy/internal/auth"
 	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/events"
 	"github.com/google/uuid"
 )
 
+const maxChirpLength int = 140
+
 type chirp struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -21,6 +24,16 @@ type chirp struct {
 	UserID    uuid.UUID `json:"user_id"`
 }
 
+func chirpFromDatabase(dbChirp database.Chirp) chirp {
+	return chirp{
+		ID:        dbChirp.ID,
+		CreatedAt: dbChirp.CreatedAt,
+		UpdatedAt: dbChirp.UpdatedAt,
+		Body:      dbChirp.Body,
+		UserID:    dbChirp.UserID,
+	}
+}
+
 func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 	type response struct {
 		chirp
@@ -109,17 +122,16 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		chirp
 	}
 
-	bearerToken, err := auth.GetBearerToken(r.Header)
+	userId := principalFromContext(r.Context()).UserID
+
+	restricted, err := cfg.isRestrictedUnverified(r.Context(), userId, restrictChirp)
 	if err != nil {
-		log.Printf("Unable to fetch bearer token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		log.Printf("Unable to check email verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
-
-	userId, err := auth.ValidateJWT(bearerToken, cfg.jwtSecret)
-	if err != nil {
-		log.Printf("Invalid token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+	if restricted {
+		respondWithError(w, http.StatusForbidden, "Email address is not verified")
 		return
 	}
 
@@ -131,7 +143,6 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	const maxChirpLength = 140
 	if len(params.Body) > maxChirpLength {
 		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
 		return
@@ -146,9 +157,12 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		log.Printf("Error creating chirp: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Unable to create chirp")
+		return
 	}
 
-	respondWithJson(w, http.StatusCreated, response{
+	cfg.notifyMentions(r.Context(), dbChirp)
+
+	resp := response{
 		chirp: chirp{
 			ID:        dbChirp.ID,
 			CreatedAt: dbChirp.CreatedAt,
@@ -156,7 +170,10 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 			Body:      dbChirp.Body,
 			UserID:    dbChirp.UserID,
 		},
-	})
+	}
+	cfg.publishEvent(r.Context(), events.ChirpCreated, resp.chirp, nil)
+
+	respondWithJson(w, http.StatusCreated, resp)
 }
 
 func replaceProfanities(text string) string {
@@ -176,18 +193,7 @@ func replaceProfanities(text string) string {
 }
 
 func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	bearer, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Unable to get bearer token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
-		return
-	}
-
-	userId, err := auth.ValidateJWT(bearer, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
-		return
-	}
+	userId := principalFromContext(r.Context()).UserID
 
 	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
@@ -214,5 +220,27 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	cfg.publishEvent(r.Context(), events.ChirpDeleted, chirpFromDatabase(dbChirp), nil)
+
 	respondWithJson(w, http.StatusNoContent, http.StatusText(http.StatusNoContent))
 }
+
+// parseHashtags returns the distinct hashtags in text, lowercased and
+// without the leading #.
+func parseHashtags(text string) []string {
+	tags := []string{}
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+		end := 1
+		for end < len(word) && isHandleChar(rune(word[end])) {
+			end++
+		}
+		tag := word[1:end]
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
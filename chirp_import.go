@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/importer"
+	"github.com/google/uuid"
+)
+
+const maxImportUploadBytes int64 = 200 << 20
+const importProgressInterval int = 50
+
+// importStaleAfter is how long an import may go without progress before it
+// is taken for one that died with its process.
+const importStaleAfter time.Duration = 15 * time.Minute
+
+type chirpImport struct {
+	ID          uuid.UUID    `json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Source      string       `json:"source"`
+	Status      string       `json:"status"`
+	Total       int32        `json:"total"`
+	Processed   int32        `json:"processed"`
+	Imported    int32        `json:"imported"`
+	Skipped     []importSkip `json:"skipped"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+}
+
+type importSkip struct {
+	SourceID string `json:"source_id"`
+	Reason   string `json:"reason"`
+}
+
+func chirpImportFromDatabase(dbImport database.Import, dbSkips []database.ImportSkip) chirpImport {
+	result := chirpImport{
+		ID:        dbImport.ID,
+		CreatedAt: dbImport.CreatedAt,
+		Source:    dbImport.Source,
+		Status:    dbImport.Status,
+		Total:     dbImport.Total,
+		Processed: dbImport.Processed,
+		Imported:  dbImport.Imported,
+		Skipped:   []importSkip{},
+	}
+	if dbImport.CompletedAt.Valid {
+		result.CompletedAt = &dbImport.CompletedAt.Time
+	}
+	for _, dbSkip := range dbSkips {
+		result.Skipped = append(result.Skipped, importSkip{
+			SourceID: dbSkip.SourceID,
+			Reason:   dbSkip.Reason,
+		})
+	}
+	return result
+}
+
+func (cfg *apiConfig) handlerCreateImport(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	// Imported chirps are chirps too, so importing is restricted like
+	// POST /api/chirps.
+	restricted, err := cfg.isRestrictedUnverified(r.Context(), userId, restrictChirp)
+	if err != nil {
+		log.Printf("Unable to check email verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if restricted {
+		respondWithError(w, http.StatusForbidden, "Email address is not verified")
+		return
+	}
+
+	// zip needs random access, so the upload is spooled to disk first.
+	tmp, err := os.CreateTemp("", "chirpy-import-*.zip")
+	if err != nil {
+		log.Printf("Unable to create temporary file: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, http.MaxBytesReader(w, r.Body, maxImportUploadBytes))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Archive is too large")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to read archive")
+		return
+	}
+
+	source, entries, err := importer.Read(tmp, size)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbImport, err := cfg.dbQueries.CreateImport(r.Context(), database.CreateImportParams{
+		UserID: userId,
+		Source: source,
+		Total:  int32(len(entries)),
+	})
+	if err != nil {
+		log.Printf("Unable to create import: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	// The import runs in this process only. If the process exits first,
+	// failStaleImports marks the import as failed once it is stale, and the
+	// archive can be imported again.
+	go func() {
+		if err := cfg.runImport(context.Background(), dbImport, entries, nil); err != nil {
+			log.Printf("Import %s failed: %s", dbImport.ID, err)
+		}
+	}()
+
+	respondWithJson(w, http.StatusAccepted, chirpImportFromDatabase(dbImport, nil))
+}
+
+// failStaleImports marks imports that made no progress for importStaleAfter
+// as failed, every importStaleAfter until ctx is done. Progress is saved
+// every importProgressInterval entries, so only imports whose process
+// exited are affected, whichever instance runs this.
+func (cfg *apiConfig) failStaleImports(ctx context.Context) {
+	ticker := time.NewTicker(importStaleAfter)
+	defer ticker.Stop()
+	for {
+		failed, err := cfg.dbQueries.FailStaleImports(ctx, database.FailStaleImportsParams{
+			Error:       sql.NullString{String: "Import was interrupted", Valid: true},
+			StaleBefore: cfg.now().UTC().Add(-importStaleAfter),
+		})
+		if err != nil {
+			log.Printf("Unable to fail stale imports: %s", err)
+		} else if failed > 0 {
+			log.Printf("Marked %d stale imports as failed", failed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerGetImport(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	importId, err := uuid.Parse(r.PathValue("importID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	dbImport, err := cfg.dbQueries.GetImport(r.Context(), importId)
+	if err != nil || dbImport.UserID != userId {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	dbSkips, err := cfg.dbQueries.GetImportSkips(r.Context(), importId)
+	if err != nil {
+		log.Printf("Unable to fetch import skips: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, chirpImportFromDatabase(dbImport, dbSkips))
+}
+
+// runImport turns archive entries into chirps for the owner of dbImport,
+// keeping their original timestamps. Entries that were imported or skipped
+// before are passed over silently; entries that cannot be imported are
+// recorded as skips. progress, if not nil, is called after every entry.
+func (cfg *apiConfig) runImport(ctx context.Context, dbImport database.Import, entries []importer.Entry, progress func(processed, imported int)) error {
+	if err := cfg.dbQueries.StartImport(ctx, dbImport.ID); err != nil {
+		return err
+	}
+
+	imported := 0
+	for i, entry := range entries {
+		created, err := cfg.importEntry(ctx, dbImport, entry)
+		if err != nil {
+			if err := cfg.dbQueries.FailImport(ctx, database.FailImportParams{
+				Error: sql.NullString{String: "Unable to import chirps", Valid: true},
+				ID:    dbImport.ID,
+			}); err != nil {
+				log.Printf("Unable to mark import %s as failed: %s", dbImport.ID, err)
+			}
+			return err
+		}
+		if created {
+			imported++
+		}
+
+		processed := i + 1
+		if progress != nil {
+			progress(processed, imported)
+		}
+		if processed%importProgressInterval == 0 {
+			if err := cfg.dbQueries.UpdateImportProgress(ctx, database.UpdateImportProgressParams{
+				Processed: int32(processed),
+				Imported:  int32(imported),
+				ID:        dbImport.ID,
+			}); err != nil {
+				log.Printf("Unable to update progress of import %s: %s", dbImport.ID, err)
+			}
+		}
+	}
+
+	return cfg.dbQueries.CompleteImport(ctx, database.CompleteImportParams{
+		Processed: int32(len(entries)),
+		Imported:  int32(imported),
+		ID:        dbImport.ID,
+	})
+}
+
+// importEntry creates a chirp for entry and reports whether it did.
+func (cfg *apiConfig) importEntry(ctx context.Context, dbImport database.Import, entry importer.Entry) (bool, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	claimed, err := qtx.ClaimImportedChirp(ctx, database.ClaimImportedChirpParams{
+		UserID:   dbImport.UserID,
+		Source:   dbImport.Source,
+		SourceID: entry.SourceID,
+	})
+	if err != nil {
+		return false, err
+	}
+	if claimed == 0 {
+		return false, nil
+	}
+
+	// Skipped entries are claimed too, so that importing the same archive
+	// again records nothing new.
+	if len(entry.Body) > maxChirpLength {
+		if err := qtx.CreateImportSkip(ctx, database.CreateImportSkipParams{
+			ImportID: dbImport.ID,
+			SourceID: entry.SourceID,
+			Reason:   "Chirp is too long",
+		}); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+
+	dbChirp, err := qtx.CreateChirpAt(ctx, database.CreateChirpAtParams{
+		CreatedAt: entry.CreatedAt,
+		Body:      replaceProfanities(entry.Body),
+		UserID:    dbImport.UserID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := qtx.SetImportedChirpID(ctx, database.SetImportedChirpIDParams{
+		ChirpID:  uuid.NullUUID{UUID: dbChirp.ID, Valid: true},
+		UserID:   dbImport.UserID,
+		Source:   dbImport.Source,
+		SourceID: entry.SourceID,
+	}); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
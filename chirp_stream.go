@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/chirpy/internal/stream"
+	"github.com/google/uuid"
+)
+
+const streamReplaySize int = 1000
+const streamBufferSize int = 64
+const streamHeartbeatInterval time.Duration = 15 * time.Second
+
+// Event types published to cfg.stream. Only chirp events are public and
+// sent on /api/stream; the others go to their audience over WebSocket. A
+// reset tells an SSE client that it missed events that can no longer be
+// replayed and should refetch instead.
+const (
+	streamEventChirp        string = "chirp"
+	streamEventChirpDeleted string = "chirp_deleted"
+	streamEventNotification string = "notification"
+	streamEventMessage      string = "message"
+	streamEventUserUpgraded string = "user_upgraded"
+	streamEventReset        string = "reset"
+)
+
+// handlerStream streams new and deleted chirps as Server-Sent Events,
+// optionally only those by author_id or tagged with hashtag. Clients that
+// reconnect with Last-Event-ID are sent what they missed from the replay
+// buffer. Clients that cannot keep up are disconnected and can resume the
+// same way.
+func (cfg *apiConfig) handlerStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	authorId := uuid.Nil
+	if authorIdParam := r.URL.Query().Get("author_id"); authorIdParam != "" {
+		var err error
+		authorId, err = uuid.Parse(authorIdParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
+		}
+	}
+	hashtag := strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("hashtag"), "#"))
+
+	filter := func(event stream.Event) bool {
+		if event.Type != streamEventChirp && event.Type != streamEventChirpDeleted {
+			return false
+		}
+		if authorId != uuid.Nil && event.AuthorID != authorId {
+			return false
+		}
+		if hashtag != "" && !slices.Contains(event.Tags, hashtag) {
+			return false
+		}
+		return true
+	}
+
+	// A malformed Last-Event-ID is treated like a fresh connection.
+	lastId, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	sub, missed, complete := cfg.stream.Subscribe(lastId, filter)
+	defer cfg.stream.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		missed = []stream.Event{{Type: streamEventReset, Data: []byte("{}")}}
+	}
+	for _, event := range missed {
+		if err := stream.WriteEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if err := stream.WriteEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/importer"
+)
+
+const usage string = `Usage:
+  chirpy                          start the server
+  chirpy import <email> <archive> import a Twitter/X archive or Chirpy export
+  chirpy bootstrap-admin <email>  make the user the first admin`
+
+// runCommand runs the command line subcommand in args instead of the server.
+func (cfg *apiConfig) runCommand(args []string) error {
+	switch args[0] {
+	case "import":
+		return cfg.commandImport(args[1:])
+	case "bootstrap-admin":
+		return cfg.commandBootstrapAdmin(args[1:])
+	default:
+		return fmt.Errorf("Unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func (cfg *apiConfig) commandImport(args []string) error {
+	if len(args) != 2 {
+		return errors.New(usage)
+	}
+	email, path := args[0], args[1]
+	ctx := context.Background()
+
+	dbUser, err := cfg.dbQueries.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("Unable to find user %s: %w", email, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	source, entries, err := importer.Read(f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	dbImport, err := cfg.dbQueries.CreateImport(ctx, database.CreateImportParams{
+		UserID: dbUser.ID,
+		Source: source,
+		Total:  int32(len(entries)),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Importing %d entries from %s archive as import %s\n", len(entries), source, dbImport.ID)
+	err = cfg.runImport(ctx, dbImport, entries, func(processed, imported int) {
+		fmt.Printf("\r%d/%d processed, %d imported", processed, len(entries), imported)
+	})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+
+	dbSkips, err := cfg.dbQueries.GetImportSkips(ctx, dbImport.ID)
+	if err != nil {
+		return err
+	}
+	for _, dbSkip := range dbSkips {
+		fmt.Printf("Skipped %s: %s\n", dbSkip.SourceID, dbSkip.Reason)
+	}
+	return nil
+}
+
+// commandBootstrapAdmin promotes a user to admin as long as there is no admin
+// yet. Further roles are granted through the admin API.
+func (cfg *apiConfig) commandBootstrapAdmin(args []string) error {
+	if len(args) != 1 {
+		return errors.New(usage)
+	}
+	email := args[0]
+	ctx := context.Background()
+
+	if _, err := cfg.dbQueries.GetUserByEmail(ctx, email); err != nil {
+		return fmt.Errorf("Unable to find user %s: %w", email, err)
+	}
+
+	dbUser, err := cfg.dbQueries.PromoteFirstAdmin(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("An admin already exists, ask them to grant the role")
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is now an admin\n", dbUser.Email)
+	return nil
+}
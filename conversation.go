@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/events"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const maxConversationMembers int = 10
+const maxMessageLength int = 1000
+const defaultMessagePageSize int = 50
+const maxMessagePageSize int = 100
+
+type conversation struct {
+	ID          uuid.UUID   `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	CreatedBy   uuid.UUID   `json:"created_by"`
+	IsGroup     bool        `json:"is_group"`
+	MemberIDs   []uuid.UUID `json:"member_ids"`
+	LastReadAt  *time.Time  `json:"last_read_at"`
+	UnreadCount int64       `json:"unread_count"`
+}
+
+type message struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+}
+
+func messageFromDatabase(dbMessage database.Message) message {
+	return message{
+		ID:             dbMessage.ID,
+		CreatedAt:      dbMessage.CreatedAt,
+		ConversationID: dbMessage.ConversationID,
+		SenderID:       dbMessage.SenderID,
+		Body:           dbMessage.Body,
+	}
+}
+
+// directKey identifies the one-to-one conversation between two users
+// regardless of who started it.
+func directKey(a, b uuid.UUID) string {
+	ids := []string{a.String(), b.String()}
+	slices.Sort(ids)
+	return strings.Join(ids, ":")
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// conversationMember checks that the caller belongs to the conversation in
+// the path, writing a 404 otherwise.
+func (cfg *apiConfig) conversationMember(w http.ResponseWriter, r *http.Request, userId uuid.UUID) (database.ConversationMember, bool) {
+	conversationId, err := uuid.Parse(r.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return database.ConversationMember{}, false
+	}
+
+	member, err := cfg.dbQueries.GetConversationMember(r.Context(), database.GetConversationMemberParams{
+		ConversationID: conversationId,
+		UserID:         userId,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return database.ConversationMember{}, false
+	}
+	return member, true
+}
+
+// directMessagesRefused reports whether any of memberIds other than the
+// sender turned direct messages off.
+func (cfg *apiConfig) directMessagesRefused(ctx context.Context, senderId uuid.UUID, memberIds []uuid.UUID) (bool, error) {
+	recipientIds := []uuid.UUID{}
+	for _, memberId := range memberIds {
+		if memberId != senderId {
+			recipientIds = append(recipientIds, memberId)
+		}
+	}
+	refusing, err := cfg.dbQueries.GetUsersRefusingDirectMessages(ctx, recipientIds)
+	if err != nil {
+		return false, err
+	}
+	return len(refusing) > 0, nil
+}
+
+func (cfg *apiConfig) handlerCreateConversation(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MemberIDs []uuid.UUID `json:"member_ids"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	memberIds := []uuid.UUID{}
+	for _, memberId := range params.MemberIDs {
+		if memberId != userId && !slices.Contains(memberIds, memberId) {
+			memberIds = append(memberIds, memberId)
+		}
+	}
+	if len(memberIds) == 0 {
+		respondWithError(w, http.StatusBadRequest, "A conversation needs at least one other member")
+		return
+	}
+	if len(memberIds)+1 > maxConversationMembers {
+		respondWithError(w, http.StatusBadRequest, "Too many conversation members")
+		return
+	}
+
+	restricted, err := cfg.isRestrictedUnverified(r.Context(), userId, restrictMessage)
+	if err != nil {
+		log.Printf("Unable to check email verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if restricted {
+		respondWithError(w, http.StatusForbidden, "Email address is not verified")
+		return
+	}
+
+	refused, err := cfg.directMessagesRefused(r.Context(), userId, memberIds)
+	if err != nil {
+		log.Printf("Unable to check direct message settings: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if refused {
+		respondWithError(w, http.StatusForbidden, "A member does not accept direct messages")
+		return
+	}
+
+	isGroup := len(memberIds) > 1
+	var key sql.NullString
+	if !isGroup {
+		key = sql.NullString{String: directKey(userId, memberIds[0]), Valid: true}
+		existing, err := cfg.dbQueries.GetDirectConversation(r.Context(), key)
+		if err == nil {
+			cfg.respondWithConversation(w, r, http.StatusOK, existing, userId)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Unable to fetch direct conversation: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	dbConversation, err := qtx.CreateConversation(r.Context(), database.CreateConversationParams{
+		CreatedBy: userId,
+		IsGroup:   isGroup,
+		DirectKey: key,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "Conversation already exists")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to create conversation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	for _, memberId := range append([]uuid.UUID{userId}, memberIds...) {
+		err := qtx.AddConversationMember(r.Context(), database.AddConversationMemberParams{
+			ConversationID: dbConversation.ID,
+			UserID:         memberId,
+		})
+		if isForeignKeyViolation(err) {
+			respondWithError(w, http.StatusBadRequest, "Unknown conversation member")
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to add conversation member: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit conversation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	cfg.respondWithConversation(w, r, http.StatusCreated, dbConversation, userId)
+}
+
+func (cfg *apiConfig) respondWithConversation(w http.ResponseWriter, r *http.Request, status int, dbConversation database.Conversation, userId uuid.UUID) {
+	memberIds, err := cfg.dbQueries.GetConversationMemberIDs(r.Context(), dbConversation.ID)
+	if err != nil {
+		log.Printf("Unable to fetch conversation members: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, status, conversation{
+		ID:        dbConversation.ID,
+		CreatedAt: dbConversation.CreatedAt,
+		UpdatedAt: dbConversation.UpdatedAt,
+		CreatedBy: dbConversation.CreatedBy,
+		IsGroup:   dbConversation.IsGroup,
+		MemberIDs: memberIds,
+	})
+}
+
+func (cfg *apiConfig) handlerGetConversations(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbConversations, err := cfg.dbQueries.GetConversationsForUser(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch conversations: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	conversations := []conversation{}
+	for _, dbConversation := range dbConversations {
+		memberIds, err := cfg.dbQueries.GetConversationMemberIDs(r.Context(), dbConversation.ID)
+		if err != nil {
+			log.Printf("Unable to fetch conversation members: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		c := conversation{
+			ID:          dbConversation.ID,
+			CreatedAt:   dbConversation.CreatedAt,
+			UpdatedAt:   dbConversation.UpdatedAt,
+			CreatedBy:   dbConversation.CreatedBy,
+			IsGroup:     dbConversation.IsGroup,
+			MemberIDs:   memberIds,
+			UnreadCount: dbConversation.UnreadCount,
+		}
+		if dbConversation.LastReadAt.Valid {
+			c.LastReadAt = &dbConversation.LastReadAt.Time
+		}
+		conversations = append(conversations, c)
+	}
+
+	respondWithJson(w, http.StatusOK, conversations)
+}
+
+// handlerGetMessages returns messages newest first. Older pages are fetched
+// by passing the ID of the last message received as before.
+func (cfg *apiConfig) handlerGetMessages(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Messages   []message  `json:"messages"`
+		NextBefore *uuid.UUID `json:"next_before"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	member, ok := cfg.conversationMember(w, r, userId)
+	if !ok {
+		return
+	}
+
+	limit := defaultMessagePageSize
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(parsed, maxMessagePageSize)
+	}
+
+	params := database.GetMessagesParams{
+		ConversationID: member.ConversationID,
+		MaxResults:     int32(limit),
+	}
+	if beforeParam := r.URL.Query().Get("before"); beforeParam != "" {
+		beforeId, err := uuid.Parse(beforeParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid before cursor")
+			return
+		}
+		before, err := cfg.dbQueries.GetMessage(r.Context(), beforeId)
+		if err != nil || before.ConversationID != member.ConversationID {
+			respondWithError(w, http.StatusBadRequest, "Invalid before cursor")
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: before.CreatedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: before.ID, Valid: true}
+	}
+
+	dbMessages, err := cfg.dbQueries.GetMessages(r.Context(), params)
+	if err != nil {
+		log.Printf("Unable to fetch messages: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	resp := response{Messages: []message{}}
+	for _, dbMessage := range dbMessages {
+		resp.Messages = append(resp.Messages, messageFromDatabase(dbMessage))
+	}
+	if len(dbMessages) == limit {
+		resp.NextBefore = &dbMessages[len(dbMessages)-1].ID
+	}
+
+	respondWithJson(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerCreateMessage(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	member, ok := cfg.conversationMember(w, r, userId)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(params.Body) == "" {
+		respondWithError(w, http.StatusBadRequest, "Message is empty")
+		return
+	}
+	if len(params.Body) > maxMessageLength {
+		respondWithError(w, http.StatusBadRequest, "Message is too long")
+		return
+	}
+
+	restricted, err := cfg.isRestrictedUnverified(r.Context(), userId, restrictMessage)
+	if err != nil {
+		log.Printf("Unable to check email verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if restricted {
+		respondWithError(w, http.StatusForbidden, "Email address is not verified")
+		return
+	}
+
+	// A user who turns direct messages off stops getting them in existing
+	// direct conversations too. Group conversations go on as before.
+	dbConversation, err := cfg.dbQueries.GetConversation(r.Context(), member.ConversationID)
+	if err != nil {
+		log.Printf("Unable to fetch conversation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !dbConversation.IsGroup {
+		memberIds, err := cfg.dbQueries.GetConversationMemberIDs(r.Context(), member.ConversationID)
+		if err != nil {
+			log.Printf("Unable to fetch conversation members: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		refused, err := cfg.directMessagesRefused(r.Context(), userId, memberIds)
+		if err != nil {
+			log.Printf("Unable to check direct message settings: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if refused {
+			respondWithError(w, http.StatusForbidden, "Recipient does not accept direct messages")
+			return
+		}
+	}
+
+	dbMessage, err := cfg.createMessage(r.Context(), member, params.Body)
+	if err != nil {
+		log.Printf("Unable to create message: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	memberIds, err := cfg.dbQueries.GetConversationMemberIDs(r.Context(), member.ConversationID)
+	if err != nil {
+		log.Printf("Unable to fetch conversation members: %s", err)
+	}
+	for _, memberId := range memberIds {
+		cfg.notify(r.Context(), memberId, notificationMessage, member.ConversationID, userId)
+	}
+
+	cfg.publishEvent(r.Context(), events.MessageCreated, messageFromDatabase(dbMessage), memberIds)
+
+	respondWithJson(w, http.StatusCreated, messageFromDatabase(dbMessage))
+}
+
+// createMessage stores a message from member, bumps the conversation to the
+// top of everyone's list and marks it read for the sender.
+func (cfg *apiConfig) createMessage(ctx context.Context, member database.ConversationMember, body string) (database.Message, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Message{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	dbMessage, err := qtx.CreateMessage(ctx, database.CreateMessageParams{
+		ConversationID: member.ConversationID,
+		SenderID:       member.UserID,
+		Body:           body,
+	})
+	if err != nil {
+		return database.Message{}, err
+	}
+
+	if err := qtx.TouchConversation(ctx, member.ConversationID); err != nil {
+		return database.Message{}, err
+	}
+
+	if err := qtx.MarkConversationRead(ctx, database.MarkConversationReadParams{
+		ReadAt:         dbMessage.CreatedAt,
+		ConversationID: member.ConversationID,
+		UserID:         member.UserID,
+	}); err != nil {
+		return database.Message{}, err
+	}
+
+	return dbMessage, tx.Commit()
+}
+
+// handlerMarkConversationRead moves the caller's read marker up to the given
+// message, or to now when no message is given. Markers never move back.
+func (cfg *apiConfig) handlerMarkConversationRead(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MessageID *uuid.UUID `json:"message_id"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	member, ok := cfg.conversationMember(w, r, userId)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&params); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+	}
+
+	readAt := time.Now().UTC()
+	if params.MessageID != nil {
+		dbMessage, err := cfg.dbQueries.GetMessage(r.Context(), *params.MessageID)
+		if err != nil || dbMessage.ConversationID != member.ConversationID {
+			respondWithError(w, http.StatusBadRequest, "Unknown message")
+			return
+		}
+		readAt = dbMessage.CreatedAt
+	}
+
+	if err := cfg.dbQueries.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ReadAt:         readAt,
+		ConversationID: member.ConversationID,
+		UserID:         userId,
+	}); err != nil {
+		log.Printf("Unable to mark conversation read: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
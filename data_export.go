@@ -0,0 +1,344 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/imaging"
+	"github.com/google/uuid"
+)
+
+const exportLinkExpiresIn time.Duration = 15 * time.Minute
+const dataExportTimeout time.Duration = 10 * time.Minute
+
+const dataExportCompleted string = "completed"
+
+type dataExport struct {
+	ID                uuid.UUID  `json:"id"`
+	CreatedAt         time.Time  `json:"created_at"`
+	Status            string     `json:"status"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+}
+
+// exportedProfile is the profile.json entry of an archive. Unlike the public
+// profile it includes private fields such as the email address.
+type exportedProfile struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Email           string    `json:"email"`
+	IsEmailVerified bool      `json:"is_email_verified"`
+	Handle          string    `json:"handle"`
+	DisplayName     string    `json:"display_name"`
+	IsChirpyRed     bool      `json:"is_chirpy_red"`
+}
+
+var profileTemplate = template.Must(template.New("profile").Parse(`<!DOCTYPE html>
+<html>
+  <head><meta charset="utf-8"><title>Chirpy profile</title></head>
+  <body>
+    <h1>Your Chirpy profile</h1>
+    <dl>
+      <dt>ID</dt><dd>{{.ID}}</dd>
+      <dt>Email</dt><dd>{{.Email}}</dd>
+      <dt>Handle</dt><dd>{{.Handle}}</dd>
+      <dt>Display name</dt><dd>{{.DisplayName}}</dd>
+      <dt>Joined</dt><dd>{{.CreatedAt.Format "2006-01-02 15:04:05 MST"}}</dd>
+      <dt>Chirpy Red</dt><dd>{{.IsChirpyRed}}</dd>
+    </dl>
+    <p><a href="chirps.html">Chirps</a></p>
+  </body>
+</html>
+`))
+
+var chirpsTemplate = template.Must(template.New("chirps").Parse(`<!DOCTYPE html>
+<html>
+  <head><meta charset="utf-8"><title>Chirpy chirps</title></head>
+  <body>
+    <h1>Your chirps</h1>
+    <ul>
+    {{- range .}}
+      <li><time>{{.CreatedAt.Format "2006-01-02 15:04:05 MST"}}</time>: {{.Body}}</li>
+    {{- else}}
+      <li>You have not chirped yet.</li>
+    {{- end}}
+    </ul>
+    <p><a href="profile.html">Profile</a></p>
+  </body>
+</html>
+`))
+
+func dataExportMessage(exportId uuid.UUID, expires int64) string {
+	return fmt.Sprintf("data-export:%s:%d", exportId, expires)
+}
+
+func (cfg *apiConfig) dataExportFromDatabase(dbExport database.DataExport) dataExport {
+	export := dataExport{
+		ID:        dbExport.ID,
+		CreatedAt: dbExport.CreatedAt,
+		Status:    dbExport.Status,
+	}
+	if dbExport.CompletedAt.Valid {
+		export.CompletedAt = &dbExport.CompletedAt.Time
+	}
+	if dbExport.Status == dataExportCompleted {
+		expiresAt := time.Now().UTC().Add(exportLinkExpiresIn).Truncate(time.Second)
+		expires := expiresAt.Unix()
+		signature := auth.MakeSignature(dataExportMessage(dbExport.ID, expires), cfg.signingSecret)
+		export.DownloadURL = fmt.Sprintf("/api/users/me/export/%s?expires=%d&signature=%s", dbExport.ID, expires, signature)
+		export.DownloadExpiresAt = &expiresAt
+	}
+	return export
+}
+
+func (cfg *apiConfig) handlerCreateDataExport(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbExport, err := cfg.dbQueries.CreateDataExport(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to create data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	go cfg.runDataExport(dbExport.ID, userId)
+
+	respondWithJson(w, http.StatusAccepted, cfg.dataExportFromDatabase(dbExport))
+}
+
+// handlerGetDataExport reports the status of an export to its owner. Requests
+// carrying a valid signature instead download the archive, so the link can
+// be opened in a browser without a bearer token.
+func (cfg *apiConfig) handlerGetDataExport(w http.ResponseWriter, r *http.Request) {
+	exportId, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if r.URL.Query().Has("signature") {
+		cfg.serveDataExport(w, r, exportId)
+		return
+	}
+
+	// The route is not wrapped in authenticated, which would refuse the
+	// signed link, so the status is checked for the owner here.
+	caller, err := cfg.authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy"`)
+		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if !caller.firstParty() {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy", error="insufficient_scope"`)
+		respondWithError(w, http.StatusForbidden, "Token cannot be used for this request")
+		return
+	}
+	userId := caller.UserID
+
+	dbExport, err := cfg.dbQueries.GetDataExport(r.Context(), exportId)
+	if err != nil || dbExport.UserID != userId {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, cfg.dataExportFromDatabase(dbExport))
+}
+
+func (cfg *apiConfig) serveDataExport(w http.ResponseWriter, r *http.Request, exportId uuid.UUID) {
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, "Invalid download link")
+		return
+	}
+	if !auth.ValidateSignature(dataExportMessage(exportId, expires), r.URL.Query().Get("signature"), cfg.signingSecret) {
+		respondWithError(w, http.StatusForbidden, "Invalid download link")
+		return
+	}
+	if time.Now().UTC().Unix() > expires {
+		respondWithError(w, http.StatusForbidden, "Download link has expired")
+		return
+	}
+
+	dbExport, err := cfg.dbQueries.GetDataExport(r.Context(), exportId)
+	if err != nil || dbExport.Status != dataExportCompleted || !dbExport.FileKey.Valid {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	archive, err := cfg.exports.Open(r.Context(), dbExport.FileKey.String)
+	if err != nil {
+		log.Printf("Unable to open data export: %s", err)
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	defer archive.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, exportId))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, archive); err != nil {
+		log.Printf("Unable to send data export: %s", err)
+	}
+}
+
+func (cfg *apiConfig) runDataExport(exportId, userId uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), dataExportTimeout)
+	defer cancel()
+
+	if err := cfg.dbQueries.StartDataExport(ctx, exportId); err != nil {
+		log.Printf("Unable to start data export %s: %s", exportId, err)
+		return
+	}
+
+	key, err := cfg.buildDataExport(ctx, exportId, userId)
+	if err != nil {
+		log.Printf("Data export %s failed: %s", exportId, err)
+		if err := cfg.dbQueries.FailDataExport(ctx, database.FailDataExportParams{
+			Error: sql.NullString{String: "Unable to build archive", Valid: true},
+			ID:    exportId,
+		}); err != nil {
+			log.Printf("Unable to mark data export %s as failed: %s", exportId, err)
+		}
+		return
+	}
+
+	if err := cfg.dbQueries.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		FileKey: sql.NullString{String: key, Valid: true},
+		ID:      exportId,
+	}); err != nil {
+		log.Printf("Unable to complete data export %s: %s", exportId, err)
+	}
+}
+
+// buildDataExport writes the user's archive to a temporary file and moves it
+// into export storage, returning its key.
+func (cfg *apiConfig) buildDataExport(ctx context.Context, exportId, userId uuid.UUID) (string, error) {
+	tmp, err := os.CreateTemp("", "chirpy-export-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := cfg.writeDataExport(ctx, tmp, userId); err != nil {
+		return "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	key := userId.String() + "/" + exportId.String() + ".zip"
+	if err := cfg.exports.Put(ctx, key, tmp); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (cfg *apiConfig) writeDataExport(ctx context.Context, w io.Writer, userId uuid.UUID) error {
+	dbUser, err := cfg.dbQueries.GetUserByID(ctx, userId)
+	if err != nil {
+		return err
+	}
+	dbChirps, err := cfg.dbQueries.GetChirpsByUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	profile := exportedProfile{
+		ID:              dbUser.ID,
+		CreatedAt:       dbUser.CreatedAt,
+		UpdatedAt:       dbUser.UpdatedAt,
+		Email:           dbUser.Email,
+		IsEmailVerified: dbUser.EmailVerifiedAt.Valid,
+		Handle:          dbUser.Handle.String,
+		DisplayName:     dbUser.DisplayName,
+		IsChirpyRed:     dbUser.IsChirpyRed,
+	}
+	chirps := []chirp{}
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, chirp{
+			ID:        dbChirp.ID,
+			CreatedAt: dbChirp.CreatedAt,
+			UpdatedAt: dbChirp.UpdatedAt,
+			Body:      dbChirp.Body,
+			UserID:    dbChirp.UserID,
+		})
+	}
+
+	archive := zip.NewWriter(w)
+
+	if err := writeZipJSON(archive, "profile.json", profile); err != nil {
+		return err
+	}
+	if err := writeZipTemplate(archive, "profile.html", profileTemplate, profile); err != nil {
+		return err
+	}
+	if err := writeZipJSON(archive, "chirps.json", chirps); err != nil {
+		return err
+	}
+	if err := writeZipTemplate(archive, "chirps.html", chirpsTemplate, chirps); err != nil {
+		return err
+	}
+	if err := cfg.writeZipImages(ctx, archive, "media/avatar", dbUser.AvatarKey, avatarSpec); err != nil {
+		return err
+	}
+	if err := cfg.writeZipImages(ctx, archive, "media/banner", dbUser.BannerKey, bannerSpec); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeZipJSON(archive *zip.Writer, name string, payload any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(payload)
+}
+
+func writeZipTemplate(archive *zip.Writer, name string, tmpl *template.Template, data any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(f, data)
+}
+
+func (cfg *apiConfig) writeZipImages(ctx context.Context, archive *zip.Writer, dir string, prefix sql.NullString, spec imaging.Spec) error {
+	if !prefix.Valid {
+		return nil
+	}
+	for _, variant := range spec.Variants {
+		src, err := cfg.media.Open(ctx, variantKey(prefix.String, spec, variant))
+		if err != nil {
+			return err
+		}
+		f, err := archive.Create(dir + "/" + variant.Name + "." + spec.Format.Extension())
+		if err == nil {
+			_, err = io.Copy(f, src)
+		}
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
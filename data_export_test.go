@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/storage"
+	"github.com/google/uuid"
+)
+
+// rowDriver is a database driver whose queries all return the same row.
+type rowDriver struct {
+	columns []string
+	row     []driver.Value
+}
+
+func (d rowDriver) Open(name string) (driver.Conn, error) {
+	return rowConn{d}, nil
+}
+
+type rowConn struct {
+	driver rowDriver
+}
+
+func (c rowConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c rowConn) Close() error {
+	return nil
+}
+
+func (c rowConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c rowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &rowRows{driver: c.driver}, nil
+}
+
+type rowRows struct {
+	driver rowDriver
+	done   bool
+}
+
+func (r *rowRows) Columns() []string {
+	return r.driver.columns
+}
+
+func (r *rowRows) Close() error {
+	return nil
+}
+
+func (r *rowRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.driver.row)
+	return nil
+}
+
+func TestSignedDataExportDownload(t *testing.T) {
+	exportId := uuid.New()
+	userId := uuid.New()
+	fileKey := userId.String() + "/" + exportId.String() + ".zip"
+	now := time.Now().UTC()
+
+	sql.Register("signed-data-export", rowDriver{
+		columns: []string{"id", "created_at", "updated_at", "user_id", "status", "file_key", "error", "completed_at"},
+		row:     []driver.Value{exportId.String(), now, now, userId.String(), dataExportCompleted, fileKey, nil, now},
+	})
+	db, err := sql.Open("signed-data-export", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	exports, err := storage.NewLocal(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exports.Put(context.Background(), fileKey, strings.NewReader("archive")); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &apiConfig{
+		dbQueries:     database.New(db),
+		signingSecret: "secret",
+		exports:       exports,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/users/me/export/{exportID}", cfg.handlerGetDataExport)
+
+	dbExport, err := cfg.dbQueries.GetDataExport(context.Background(), exportId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloadURL := cfg.dataExportFromDatabase(dbExport).DownloadURL
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{"signed link", downloadURL, http.StatusOK, "archive"},
+		{"forged signature", strings.Replace(downloadURL, "signature=", "signature=x", 1), http.StatusForbidden, ""},
+		{"no signature", "/api/users/me/export/" + exportId.String(), http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.url, nil))
+			if rec.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, test.wantStatus, rec.Body)
+			}
+			if test.wantBody != "" && rec.Body.String() != test.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, test.wantBody)
+			}
+		})
+	}
+}
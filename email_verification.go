@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const emailVerificationExpiresIn time.Duration = 24 * time.Hour
+
+// Actions that can be listed in UNVERIFIED_RESTRICTIONS to forbid them for
+// users who have not verified their email address yet.
+const (
+	restrictChirp   string = "chirp"
+	restrictMessage string = "message"
+)
+
+func parseRestrictions(value string) map[string]bool {
+	restrictions := map[string]bool{}
+	for _, action := range strings.Split(value, ",") {
+		action = strings.TrimSpace(action)
+		if action != "" {
+			restrictions[action] = true
+		}
+	}
+	return restrictions
+}
+
+// isRestrictedUnverified reports whether action is forbidden for the user
+// because their email address is not verified.
+func (cfg *apiConfig) isRestrictedUnverified(ctx context.Context, userId uuid.UUID, action string) (bool, error) {
+	if !cfg.unverifiedRestrictions[action] {
+		return false, nil
+	}
+	dbUser, err := cfg.dbQueries.GetUserByID(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	return !dbUser.EmailVerifiedAt.Valid, nil
+}
+
+// sendVerificationEmail invalidates any outstanding verification tokens of
+// the user and mails a new one.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, dbUser database.User) error {
+	token, err := auth.MakeRandomToken()
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.dbQueries.InvalidateEmailVerificationTokens(ctx, dbUser.ID); err != nil {
+		return err
+	}
+
+	if err := cfg.dbQueries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationExpiresIn),
+	}); err != nil {
+		return err
+	}
+
+	cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf(
+			"Use this code to verify your email address:\n\n%s\n\nThe code expires in %s.\n",
+			token, emailVerificationExpiresIn,
+		),
+	})
+	return nil
+}
+
+// sendMail delivers msg in the background so slow mail servers don't hold up
+// requests.
+func (cfg *apiConfig) sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := cfg.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Unable to send mail: %s", err)
+		}
+	}()
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	userId, err := qtx.UseEmailVerificationToken(r.Context(), auth.HashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to use verification token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := qtx.SetUserEmailVerified(r.Context(), userId); err != nil {
+		log.Printf("Unable to mark email as verified: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit email verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	if dbUser.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email address is already verified")
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+		log.Printf("Unable to send verification email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -3,9 +3,11 @@ module example.com/chirpy
 go 1.23.2
 
 require (
+	github.com/coder/websocket v1.8.14
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.28.0
+	golang.org/x/image v0.21.0
 )
@@ -1,13 +1,20 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -26,51 +33,200 @@ func CheckPasswordHash(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func MakeJWT(userId uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    tokenIssuer,
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userId.String(),
-	})
-	return token.SignedString([]byte(tokenSecret))
+// dummyPasswordHash is hashed at the same cost as HashPassword, so that
+// comparing against it takes as long as checking a real password.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("chirpy-no-such-account"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// CheckNoPasswordHash takes as long as CheckPasswordHash but always fails.
+// It stands in for it when there is no account, so that response times do
+// not reveal which emails are registered.
+func CheckNoPasswordHash(password string) error {
+	bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+	return bcrypt.ErrMismatchedHashAndPassword
+}
+
+// Roles a user can have, from least to most privileged.
+const (
+	RoleUser      string = "user"
+	RoleModerator string = "moderator"
+	RoleAdmin     string = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// HasRole reports whether role grants at least the privileges of required.
+// Unknown roles grant nothing.
+func HasRole(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// Scopes a third-party app can be granted.
+const (
+	ScopeChirpsRead  string = "chirps:read"
+	ScopeChirpsWrite string = "chirps:write"
+	ScopeProfile     string = "profile"
+)
+
+var knownScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfile}
+
+// ParseScopes splits a space separated OAuth scope parameter into known
+// scopes, sorted and without duplicates.
+func ParseScopes(scope string) ([]string, error) {
+	scopes := []string{}
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(knownScopes, s) {
+			return nil, fmt.Errorf("Unknown scope %q", s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	slices.Sort(scopes)
+	return scopes, nil
+}
+
+// Claims are the contents of an access token. SessionID is the refresh
+// token family the token was issued from, or uuid.Nil for tokens that do
+// not belong to a session. ExpiresAt is set by ParseJWT and ignored by
+// MakeJWT.
+//
+// Tokens issued to a third-party app carry the app's ClientID and only
+// allow what their Scopes grant. Tokens of Chirpy's own clients have no
+// ClientID and allow everything.
+type Claims struct {
+	UserID    uuid.UUID
+	Role      string
+	SessionID uuid.UUID
+	ClientID  uuid.UUID
+	Scopes    []string
+	ExpiresAt time.Time
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&jwt.RegisteredClaims{},
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
-	)
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+}
+
+// MakeJWT returns an access token for claims signed with keys.
+func MakeJWT(claims Claims, keys *KeySet, expiresIn time.Duration) (string, error) {
+	var sessionId, clientId string
+	if claims.SessionID != uuid.Nil {
+		sessionId = claims.SessionID.String()
+	}
+	if claims.ClientID != uuid.Nil {
+		clientId = claims.ClientID.String()
+	}
+
+	return keys.sign(tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   claims.UserID.String(),
+		},
+		Role:      claims.Role,
+		SessionID: sessionId,
+		ClientID:  clientId,
+		Scope:     strings.Join(claims.Scopes, " "),
+	})
+}
 
+// ValidateJWT validates an access token of one of Chirpy's own clients and
+// returns the user it was issued to. Tokens of third-party apps are
+// rejected.
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, keys)
 	if err != nil {
 		return uuid.Nil, err
 	}
+	if claims.ClientID != uuid.Nil {
+		return uuid.Nil, errors.New("Token was issued to a third-party app")
+	}
+	return claims.UserID, nil
+}
+
+// ParseJWT validates an access token against keys and returns its claims,
+// whoever it was issued to. Tokens issued before roles existed carry the
+// user role.
+func ParseJWT(tokenString string, keys *KeySet) (Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &tokenClaims{}, keys.verificationKey)
+
+	if err != nil {
+		return Claims{}, err
+	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
 		log.Printf("Unable to get issuer from claims: %s", err)
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 	if issuer != tokenIssuer {
-		return uuid.Nil, errors.New("Invalid issuer")
+		return Claims{}, errors.New("Invalid issuer")
 	}
 
 	expirationTime, err := token.Claims.GetExpirationTime()
 	if err != nil {
 		log.Printf("Unable to get expiration time from claims: %s", err)
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 	if expirationTime.UTC().Before(time.Now().UTC()) {
-		return uuid.Nil, errors.New("Token is expired")
+		return Claims{}, errors.New("Token is expired")
 	}
 
 	subject, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("Unable to retrieve subject from claims: %s", err)
+		return Claims{}, fmt.Errorf("Unable to retrieve subject from claims: %s", err)
+	}
+	userId, err := uuid.Parse(subject)
+	if err != nil {
+		return Claims{}, err
 	}
 
-	return uuid.Parse(subject)
+	parsed := token.Claims.(*tokenClaims)
+	role := parsed.Role
+	if role == "" {
+		role = RoleUser
+	}
+	var sessionId uuid.UUID
+	if parsed.SessionID != "" {
+		sessionId, err = uuid.Parse(parsed.SessionID)
+		if err != nil {
+			return Claims{}, fmt.Errorf("Invalid session ID: %s", err)
+		}
+	}
+
+	var clientId uuid.UUID
+	var scopes []string
+	if parsed.ClientID != "" {
+		clientId, err = uuid.Parse(parsed.ClientID)
+		if err != nil {
+			return Claims{}, fmt.Errorf("Invalid client ID: %s", err)
+		}
+		scopes = strings.Fields(parsed.Scope)
+	}
+
+	return Claims{
+		UserID:    userId,
+		Role:      role,
+		SessionID: sessionId,
+		ClientID:  clientId,
+		Scopes:    scopes,
+		ExpiresAt: expirationTime.UTC(),
+	}, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -105,10 +261,115 @@ func getValueFromAuthorizationHeader(headers http.Header, key string) (string, e
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeRandomToken()
+}
+
+// MakeRandomToken returns 32 bytes of random data, hex encoded. It is used
+// for opaque single-use tokens such as email verification codes.
+func MakeRandomToken() (string, error) {
 	rawData := make([]byte, 32)
 	if _, err := rand.Read(rawData); err != nil {
-		log.Printf("Unable to create raw data for refresh token")
-		return "", errors.New("Unable to create refresh token")
+		log.Printf("Unable to create raw data for random token")
+		return "", errors.New("Unable to create random token")
 	}
 	return hex.EncodeToString(rawData), nil
 }
+
+// PersonalAccessTokenPrefix starts every personal access token, so they can
+// be told apart from access tokens and found by secret scanners.
+const PersonalAccessTokenPrefix string = "chirpy_pat_"
+
+// MakePersonalAccessToken returns a new random personal access token.
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRandomToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+// IsPersonalAccessToken reports whether token looks like a personal access
+// token rather than an access token.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// MakeRecoveryCode returns a random 80 bit code in groups of four
+// characters, such as "k3vq-7hxa-p2mw-dn5c", that is easy to write down.
+func MakeRecoveryCode() (string, error) {
+	rawData := make([]byte, 10)
+	if _, err := rand.Read(rawData); err != nil {
+		return "", errors.New("Unable to create recovery code")
+	}
+	encoded := strings.ToLower(base32.StdEncoding.EncodeToString(rawData))
+	groups := []string{}
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// NormalizeRecoveryCode returns code the way MakeRecoveryCode formats it,
+// whatever case and separators it was entered with.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code))
+	groups := []string{}
+	for i := 0; i < len(code); i += 4 {
+		groups = append(groups, code[i:min(i+4, len(code))])
+	}
+	return strings.Join(groups, "-")
+}
+
+// HashToken returns the hex encoded SHA-256 digest of token. Opaque tokens
+// are only ever stored in this form.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckTokenHash reports whether hash is the digest of token, in constant
+// time.
+func CheckTokenHash(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
+
+// CheckPKCE reports whether verifier is the PKCE code verifier (RFC 7636)
+// that challenge was derived from with the S256 method.
+func CheckPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		if !strings.ContainsRune("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~", c) {
+			return false
+		}
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// MakeSignature returns the hex encoded HMAC-SHA256 of message, for example
+// to build links that expire without storing any state.
+func MakeSignature(message, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func ValidateSignature(message, signature, secret string) bool {
+	expected, err := hex.DecodeString(MakeSignature(message, secret))
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
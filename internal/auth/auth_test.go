@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -63,10 +64,18 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
+func TestCheckNoPasswordHash(t *testing.T) {
+	for _, password := range []string{"", "superSecret123!", "chirpy-no-such-account"} {
+		if err := CheckNoPasswordHash(password); err == nil {
+			t.Errorf("CheckNoPasswordHash(%q) accepted a password", password)
+		}
+	}
+}
+
 func TestValidateJWT(t *testing.T) {
 	userId := uuid.New()
 	secret := "supersecret"
-	tokenString, _ := MakeJWT(userId, secret, time.Hour)
+	tokenString, _ := MakeJWT(Claims{UserID: userId, Role: RoleUser}, NewHMACKeySet(secret), time.Hour)
 
 	tests := []struct {
 		name        string
@@ -99,7 +108,7 @@ func TestValidateJWT(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(*testing.T) {
-			uuid, err := ValidateJWT(test.tokenString, test.tokenSecret)
+			uuid, err := ValidateJWT(test.tokenString, NewHMACKeySet(test.tokenSecret))
 			if uuid != test.wantUserId {
 				t.Errorf("ValidateJWT() uuid.UUID = %v, want %v", uuid, test.wantUserId)
 			}
@@ -110,8 +119,60 @@ func TestValidateJWT(t *testing.T) {
 	}
 }
 
+func TestParseJWT(t *testing.T) {
+	userId := uuid.New()
+	secret := "supersecret"
+	sessionId := uuid.New()
+	adminToken, _ := MakeJWT(Claims{UserID: userId, Role: RoleAdmin, SessionID: sessionId}, NewHMACKeySet(secret), time.Hour)
+	legacyToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Hour)),
+		Subject:   userId.String(),
+	}).SignedString([]byte(secret))
+
+	tests := []struct {
+		name          string
+		tokenString   string
+		wantRole      string
+		wantSessionId uuid.UUID
+		wantErr       bool
+	}{
+		{
+			name:          "Role and session claims",
+			tokenString:   adminToken,
+			wantRole:      RoleAdmin,
+			wantSessionId: sessionId,
+		},
+		{
+			name:          "No role or session claim",
+			tokenString:   legacyToken,
+			wantRole:      RoleUser,
+			wantSessionId: uuid.Nil,
+		},
+		{
+			name:        "Invalid token",
+			tokenString: "wrong.token.string",
+			wantErr:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := ParseJWT(test.tokenString, NewHMACKeySet(secret))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseJWT() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if claims.UserID != userId || claims.Role != test.wantRole || claims.SessionID != test.wantSessionId {
+				t.Errorf("ParseJWT() = %+v, want user %v with role %q and session %v", claims, userId, test.wantRole, test.wantSessionId)
+			}
+		})
+	}
+}
+
 func TestGetBearerToken(t *testing.T) {
-	tokenString, _ := MakeJWT(uuid.New(), "supersecret", time.Hour)
+	tokenString, _ := MakeJWT(Claims{UserID: uuid.New(), Role: RoleUser}, NewHMACKeySet("supersecret"), time.Hour)
 	bearer := fmt.Sprintf("Bearer %s", tokenString)
 	headers := http.Header{
 		"Authorization": []string{bearer},
@@ -214,3 +275,261 @@ func TestGetApiKey(t *testing.T) {
 	}
 
 }
+
+func TestHashToken(t *testing.T) {
+	token, _ := MakeRandomToken()
+	otherToken, _ := MakeRandomToken()
+
+	if token == otherToken {
+		t.Fatalf("MakeRandomToken() returned the same token twice")
+	}
+	if HashToken(token) != HashToken(token) {
+		t.Errorf("HashToken() is not deterministic")
+	}
+	if HashToken(token) == HashToken(otherToken) {
+		t.Errorf("HashToken() returned the same digest for different tokens")
+	}
+	if HashToken(token) == token {
+		t.Errorf("HashToken() returned the token unchanged")
+	}
+}
+
+func TestCheckTokenHash(t *testing.T) {
+	token, _ := MakeRefreshToken()
+	otherToken, _ := MakeRefreshToken()
+	hash := HashToken(token)
+
+	tests := []struct {
+		name  string
+		token string
+		hash  string
+		want  bool
+	}{
+		{"Matching token", token, hash, true},
+		{"Other token", otherToken, hash, false},
+		{"Raw token as hash", token, token, false},
+		{"Empty hash", token, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CheckTokenHash(test.token, test.hash); got != test.want {
+				t.Errorf("CheckTokenHash() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateSignature(t *testing.T) {
+	secret := "supersecret"
+	message := "export:1234"
+	signature := MakeSignature(message, secret)
+
+	tests := []struct {
+		name      string
+		message   string
+		signature string
+		secret    string
+		want      bool
+	}{
+		{
+			name:      "Valid signature",
+			message:   message,
+			signature: signature,
+			secret:    secret,
+			want:      true,
+		},
+		{
+			name:      "Tampered message",
+			message:   "export:4321",
+			signature: signature,
+			secret:    secret,
+			want:      false,
+		},
+		{
+			name:      "Wrong secret",
+			message:   message,
+			signature: signature,
+			secret:    "wrongSecret",
+			want:      false,
+		},
+		{
+			name:      "Malformed signature",
+			message:   message,
+			signature: "not-hex",
+			secret:    secret,
+			want:      false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ValidateSignature(test.message, test.signature, test.secret); got != test.want {
+				t.Errorf("ValidateSignature() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleUser, false},
+		{"superuser", RoleUser, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.role+"/"+test.required, func(t *testing.T) {
+			if got := HasRole(test.role, test.required); got != test.want {
+				t.Errorf("HasRole(%q, %q) = %v, want %v", test.role, test.required, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	code, err := MakeRecoveryCode()
+	if err != nil {
+		t.Fatalf("MakeRecoveryCode() error = %v", err)
+	}
+	if len(code) != 19 || NormalizeRecoveryCode(code) != code {
+		t.Errorf("MakeRecoveryCode() = %q, want four groups of four characters", code)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"Formatted", "k3vq-7hxa-p2mw-dn5c", "k3vq-7hxa-p2mw-dn5c"},
+		{"Upper case", "K3VQ-7HXA-P2MW-DN5C", "k3vq-7hxa-p2mw-dn5c"},
+		{"No separators", "k3vq7hxap2mwdn5c", "k3vq-7hxa-p2mw-dn5c"},
+		{"Spaces", " k3vq 7hxa p2mw dn5c ", "k3vq-7hxa-p2mw-dn5c"},
+		{"Short", "k3vq7h", "k3vq-7h"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NormalizeRecoveryCode(test.code); got != test.want {
+				t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", test.code, got, test.want)
+			}
+		})
+	}
+}
+
+func TestThirdPartyJWT(t *testing.T) {
+	keys := NewHMACKeySet("supersecret")
+	userId := uuid.New()
+	clientId := uuid.New()
+	before := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	appToken, _ := MakeJWT(Claims{
+		UserID:   userId,
+		ClientID: clientId,
+		Scopes:   []string{ScopeChirpsRead, ScopeProfile},
+	}, keys, time.Hour)
+
+	claims, err := ParseJWT(appToken, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.UserID != userId || claims.ClientID != clientId || fmt.Sprint(claims.Scopes) != "[chirps:read profile]" {
+		t.Errorf("ParseJWT() = %+v, want client %v with scopes chirps:read and profile", claims, clientId)
+	}
+	if claims.ExpiresAt.Before(before) || claims.ExpiresAt.After(before.Add(2*time.Second)) {
+		t.Errorf("ParseJWT() expires at %v, want about %v", claims.ExpiresAt, before)
+	}
+
+	if _, err := ValidateJWT(appToken, keys); err == nil {
+		t.Errorf("ValidateJWT() accepted the token of a third-party app")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   string
+		want    []string
+		wantErr bool
+	}{
+		{"Empty", "", []string{}, false},
+		{"One scope", "profile", []string{ScopeProfile}, false},
+		{"Sorted and deduplicated", "profile chirps:write  profile chirps:read", []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfile}, false},
+		{"Unknown scope", "chirps:read admin", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseScopes(test.scope)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseScopes() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("ParseScopes() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckPKCE(t *testing.T) {
+	// The example of RFC 7636, appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"Matching verifier", verifier, challenge, true},
+		{"Other verifier", "aBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", challenge, false},
+		{"Plain method", verifier, verifier, false},
+		{"Too short", "abc", "ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0", false},
+		{"Invalid characters", "dBjftJeZ4CVP+mB92K27uhbUJU1p1r/wW1gFWFOEjXk", challenge, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CheckPKCE(test.verifier, test.challenge); got != test.want {
+				t.Errorf("CheckPKCE() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsPersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error = %v", err)
+	}
+	accessToken, _ := MakeJWT(Claims{UserID: uuid.New()}, NewHMACKeySet("supersecret"), time.Hour)
+	refreshToken, _ := MakeRefreshToken()
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"Personal access token", token, true},
+		{"Access token", accessToken, false},
+		{"Refresh token", refreshToken, false},
+		{"Empty", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsPersonalAccessToken(test.token); got != test.want {
+				t.Errorf("IsPersonalAccessToken() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySet holds the keys access tokens are signed and verified with.
+//
+// Asymmetric keys are identified by a key ID that is written to the kid
+// header of every token they sign, so verification can pick the right key
+// and several keys can be valid at once while signing moves from one to the
+// next. Tokens without a kid are HS256 tokens signed with the legacy shared
+// secret.
+type KeySet struct {
+	signingKeyId string
+	signingKey   crypto.Signer
+	publicKeys   map[string]crypto.PublicKey
+	legacySecret []byte
+}
+
+// NewHMACKeySet returns a key set that signs and verifies HS256 tokens with
+// secret only.
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{
+		publicKeys:   map[string]crypto.PublicKey{},
+		legacySecret: []byte(secret),
+	}
+}
+
+// LoadKeySet reads every .pem file in dir. Each file holds an Ed25519 or RSA
+// private key, or only a public key, and its name without the extension is
+// the key ID. Tokens are signed with the private key signingKeyId, which
+// may only be left empty if dir holds a single private key, and verified
+// with any key in the directory. If legacySecret is not empty, HS256 tokens
+// signed with it are accepted too.
+//
+// Keys can be created with `openssl genpkey -algorithm ed25519`. Keys are
+// rotated in two phases, since an instance must know a key before any other
+// instance signs with it. First add the new key without signing with it,
+// either as a public key only or with signingKeyId pinned to the old key,
+// and restart every instance. Then set signingKeyId to the new key, with its
+// private key in place, and restart again; tokens signed with the old key
+// stay valid. Remove the old key once every access token it signed has
+// expired. Refresh tokens are not signed, so sessions survive rotation.
+func LoadKeySet(dir, signingKeyId, legacySecret string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+
+	keys := &KeySet{
+		publicKeys:   map[string]crypto.PublicKey{},
+		legacySecret: []byte(legacySecret),
+	}
+	privateKeys := map[string]crypto.Signer{}
+	for _, path := range paths {
+		keyId := strings.TrimSuffix(filepath.Base(path), ".pem")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, publicKey, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse key %s: %w", path, err)
+		}
+		keys.publicKeys[keyId] = publicKey
+		if privateKey != nil {
+			privateKeys[keyId] = privateKey
+		}
+	}
+
+	if signingKeyId == "" {
+		// Picking one of several keys could make an instance sign with a
+		// key that others do not know yet.
+		if len(privateKeys) > 1 {
+			return nil, fmt.Errorf("Several private keys in %s, the signing key ID must be set", dir)
+		}
+		for keyId := range privateKeys {
+			signingKeyId = keyId
+		}
+	}
+	signingKey, ok := privateKeys[signingKeyId]
+	if !ok {
+		return nil, fmt.Errorf("No private key %q in %s", signingKeyId, dir)
+	}
+	keys.signingKeyId = signingKeyId
+	keys.signingKey = signingKey
+	return keys, nil
+}
+
+// parseKey parses a PEM encoded private or public key. The private key is
+// nil if data only holds a public key.
+func parseKey(data []byte) (crypto.Signer, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("No PEM data found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch key := key.(type) {
+		case ed25519.PrivateKey:
+			return key, key.Public(), nil
+		case *rsa.PrivateKey:
+			return key, key.Public(), nil
+		}
+		return nil, nil, fmt.Errorf("Unsupported private key type %T", key)
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, key.Public(), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch key := key.(type) {
+		case ed25519.PublicKey, *rsa.PublicKey:
+			return nil, key, nil
+		}
+		return nil, nil, fmt.Errorf("Unsupported public key type %T", key)
+	}
+	return nil, nil, fmt.Errorf("Unsupported PEM block %q", block.Type)
+}
+
+// sign signs claims with the signing key, or the legacy secret if there is
+// none.
+func (k *KeySet) sign(claims jwt.Claims) (string, error) {
+	if k.signingKey == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.legacySecret)
+	}
+
+	token := jwt.NewWithClaims(signingMethod(k.signingKey.Public()), claims)
+	token.Header["kid"] = k.signingKeyId
+	return token.SignedString(k.signingKey)
+}
+
+// verificationKey returns the key to verify token with. The signing method
+// must match the key so that a public key is never used as an HMAC secret.
+func (k *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	keyId, ok := token.Header["kid"].(string)
+	if !ok {
+		if len(k.legacySecret) == 0 || token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("Token has no key ID")
+		}
+		return k.legacySecret, nil
+	}
+
+	key, ok := k.publicKeys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("Unknown key ID %q", keyId)
+	}
+	if token.Method != signingMethod(key) {
+		return nil, fmt.Errorf("Signing method %s does not match key %q", token.Method.Alg(), keyId)
+	}
+	return key, nil
+}
+
+func signingMethod(key crypto.PublicKey) jwt.SigningMethod {
+	if _, ok := key.(*rsa.PublicKey); ok {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS returns the public keys of the set, ordered by key ID. The legacy
+// secret is never included.
+func (k *KeySet) JWKS() []JWK {
+	keyIds := make([]string, 0, len(k.publicKeys))
+	for keyId := range k.publicKeys {
+		keyIds = append(keyIds, keyId)
+	}
+	slices.Sort(keyIds)
+
+	jwks := []JWK{}
+	for _, keyId := range keyIds {
+		jwk := JWK{Kid: keyId, Use: "sig"}
+		switch key := k.publicKeys[keyId].(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Alg = "EdDSA"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(key)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.Alg = "RS256"
+			jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
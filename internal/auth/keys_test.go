@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writeKey(t *testing.T, dir, keyId string, key any) {
+	t.Helper()
+	var block *pem.Block
+	switch key := key.(type) {
+	case ed25519.PublicKey, *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	if err := os.WriteFile(filepath.Join(dir, keyId+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKeySetRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     any
+		wantAlg string
+	}{
+		{"Ed25519", newEd25519Key(t), "EdDSA"},
+		{"RSA", rsaKey, "RS256"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeKey(t, dir, "2026-01", test.key)
+			keys, err := LoadKeySet(dir, "", "")
+			if err != nil {
+				t.Fatalf("LoadKeySet() error = %v", err)
+			}
+
+			userId := uuid.New()
+			tokenString, err := MakeJWT(Claims{UserID: userId, Role: RoleUser}, keys, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+
+			token, _, err := jwt.NewParser().ParseUnverified(tokenString, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Header["kid"] != "2026-01" || token.Method.Alg() != test.wantAlg {
+				t.Errorf("token header = %v, want kid 2026-01 and alg %s", token.Header, test.wantAlg)
+			}
+
+			if got, err := ValidateJWT(tokenString, keys); err != nil || got != userId {
+				t.Errorf("ValidateJWT() = %v, %v, want %v", got, err, userId)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := newEd25519Key(t)
+	writeKey(t, dir, "2026-01", oldKey)
+	oldKeys, err := LoadKeySet(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _ := MakeJWT(Claims{UserID: uuid.New()}, oldKeys, time.Hour)
+
+	// With a second private key, which one signs has to be chosen, so that
+	// no instance signs with a key the others do not know yet.
+	writeKey(t, dir, "2026-02", newEd25519Key(t))
+	if _, err := LoadKeySet(dir, "", ""); err == nil {
+		t.Errorf("LoadKeySet() picked one of several private keys to sign with")
+	}
+
+	// Once every instance knows the new key, it signs from then on, and
+	// tokens signed with the old one stay valid as long as the old key is
+	// kept.
+	keys, err := LoadKeySet(dir, "2026-02", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, _ := MakeJWT(Claims{UserID: uuid.New()}, keys, time.Hour)
+	token, _, _ := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if token.Header["kid"] != "2026-02" {
+		t.Errorf("kid = %v, want 2026-02", token.Header["kid"])
+	}
+	if _, err := ValidateJWT(oldToken, keys); err != nil {
+		t.Errorf("ValidateJWT() of token signed with old key error = %v", err)
+	}
+	if _, err := ValidateJWT(newToken, oldKeys); err == nil {
+		t.Errorf("ValidateJWT() accepted a token signed with a key it does not know")
+	}
+
+	// Until then the old key is pinned, and keys only used for
+	// verification can be kept as public keys.
+	pinned, err := LoadKeySet(dir, "2026-01", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinnedToken, _ := MakeJWT(Claims{UserID: uuid.New()}, pinned, time.Hour)
+	token, _, _ = jwt.NewParser().ParseUnverified(pinnedToken, &jwt.RegisteredClaims{})
+	if token.Header["kid"] != "2026-01" {
+		t.Errorf("kid = %v, want 2026-01", token.Header["kid"])
+	}
+
+	os.Remove(filepath.Join(dir, "2026-01.pem"))
+	writeKey(t, dir, "2026-01", oldKey.Public())
+	keys, err = LoadKeySet(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(oldToken, keys); err != nil {
+		t.Errorf("ValidateJWT() with public key error = %v", err)
+	}
+	if _, err := LoadKeySet(dir, "2026-01", ""); err == nil {
+		t.Errorf("LoadKeySet() accepted a public key for signing")
+	}
+}
+
+func TestKeySetLegacySecret(t *testing.T) {
+	dir := t.TempDir()
+	key := newEd25519Key(t)
+	writeKey(t, dir, "2026-01", key)
+	userId := uuid.New()
+	legacyToken, _ := MakeJWT(Claims{UserID: userId}, NewHMACKeySet("supersecret"), time.Hour)
+
+	withLegacy, err := LoadKeySet(dir, "", "supersecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ValidateJWT(legacyToken, withLegacy); err != nil || got != userId {
+		t.Errorf("ValidateJWT() of legacy token = %v, %v, want %v", got, err, userId)
+	}
+
+	withoutLegacy, err := LoadKeySet(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(legacyToken, withoutLegacy); err == nil {
+		t.Errorf("ValidateJWT() accepted a legacy token without a legacy secret")
+	}
+
+	// An HS256 token claiming an asymmetric key ID must not be verified with
+	// the public key as HMAC secret.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Subject:   userId.String(),
+	})
+	forged.Header["kid"] = "2026-01"
+	forgedString, _ := forged.SignedString([]byte(key.Public().(ed25519.PublicKey)))
+	if _, err := ValidateJWT(forgedString, withLegacy); err == nil {
+		t.Errorf("ValidateJWT() accepted an HS256 token with an asymmetric key ID")
+	}
+}
+
+func TestKeySetJWKS(t *testing.T) {
+	dir := t.TempDir()
+	key := newEd25519Key(t)
+	writeKey(t, dir, "2026-01", key)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "2026-02", rsaKey.Public())
+	keys, err := LoadKeySet(dir, "", "supersecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(jwks))
+	}
+	if jwks[0].Kid != "2026-01" || jwks[0].Kty != "OKP" || jwks[0].Crv != "Ed25519" || jwks[0].X == "" {
+		t.Errorf("JWKS()[0] = %+v, want the Ed25519 key", jwks[0])
+	}
+	if jwks[1].Kid != "2026-02" || jwks[1].Kty != "RSA" || jwks[1].E != "AQAB" || jwks[1].N == "" {
+		t.Errorf("JWKS()[1] = %+v, want the RSA key", jwks[1])
+	}
+
+	if got := NewHMACKeySet("supersecret").JWKS(); len(got) != 0 {
+		t.Errorf("JWKS() of an HMAC key set = %+v, want none", got)
+	}
+}
@@ -7,10 +7,23 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsByUser = `-- name: CountChirpsByUser :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1
+`
+
+func (q *Queries) CountChirpsByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (id, created_at, updated_at, body, user_id)
 VALUES (
@@ -41,6 +54,37 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 	return i, err
 }
 
+const createChirpAt = `-- name: CreateChirpAt :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $1,
+    $2,
+    $3
+)
+RETURNING id, created_at, updated_at, body, user_id
+`
+
+type CreateChirpAtParams struct {
+	CreatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) CreateChirpAt(ctx context.Context, arg CreateChirpAtParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createChirpAt, arg.CreatedAt, arg.Body, arg.UserID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+	)
+	return i, err
+}
+
 const deleteChirp = `-- name: DeleteChirp :exec
 DELETE FROM chirps WHERE id = $1
 `
@@ -100,3 +144,38 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 	)
 	return i, err
 }
+
+const getChirpsByUser = `-- name: GetChirpsByUser :many
+SELECT id, created_at, updated_at, body, user_id FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -19,20 +19,259 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
-type RefreshToken struct {
-	Token     string
+type Conversation struct {
+	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	CreatedBy uuid.UUID
+	IsGroup   bool
+	DirectKey sql.NullString
+}
+
+type ConversationMember struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	Status      string
+	FileKey     sql.NullString
+	Error       sql.NullString
+	CompletedAt sql.NullTime
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	CreatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
 }
 
-type User struct {
+type Import struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	Source      string
+	Status      string
+	Total       int32
+	Processed   int32
+	Imported    int32
+	Error       sql.NullString
+	CompletedAt sql.NullTime
+}
+
+type ImportSkip struct {
+	ImportID  uuid.UUID
+	SourceID  string
+	Reason    string
+	CreatedAt time.Time
+}
+
+type ImportedChirp struct {
+	UserID    uuid.UUID
+	Source    string
+	SourceID  string
+	ChirpID   uuid.NullUUID
+	CreatedAt time.Time
+}
+
+type List struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	OwnerID     uuid.UUID
+	Name        string
+	Description string
+	IsPrivate   bool
+}
+
+type ListMember struct {
+	ListID    uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type ListSubscription struct {
+	ListID    uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type LoginChallenge struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	DeviceName string
+	ExpiresAt  time.Time
+	Attempts   int32
+	UsedAt     sql.NullTime
+}
+
+type LoginFailure struct {
+	Key          string
+	Failures     int32
+	LastFailedAt time.Time
+}
+
+type Message struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+}
+
+type ModerationAction struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ReportID       uuid.NullUUID
+	ModeratorID    uuid.NullUUID
+	TargetUserID   uuid.NullUUID
+	ChirpID        uuid.NullUUID
+	Action         string
+	Reason         string
+	SuspendedUntil sql.NullTime
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Type      string
+	SubjectID uuid.UUID
+	ActorIds  []uuid.UUID
+	ReadAt    sql.NullTime
+}
+
+type NotificationPreference struct {
+	UserID    uuid.UUID
+	Type      string
+	Enabled   bool
+	UpdatedAt time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash            string
+	CreatedAt           time.Time
+	ClientID            uuid.UUID
+	UserID              uuid.UUID
+	RedirectUri         string
+	Scopes              []string
+	CodeChallenge       string
+	ExpiresAt           time.Time
+	UsedAt              sql.NullTime
+	FamilyID            uuid.NullUUID
+	RedirectUriProvided bool
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	RedirectUris []string
+	SecretHash   sql.NullString
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	RotatedAt  sql.NullTime
+	UserAgent  string
+	IpAddress  string
+	DeviceName string
+	LastUsedAt time.Time
+	ClientID   uuid.NullUUID
+	Scopes     []string
+}
+
+type Report struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	ReporterID     uuid.UUID
+	ReportedUserID uuid.UUID
+	ChirpID        uuid.NullUUID
+	ChirpBody      sql.NullString
+	Category       string
+	Details        string
+	Status         string
+	ResolvedAt     sql.NullTime
+}
+
+type SecurityEvent struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Type      string
+	IpAddress string
+	Details   string
+}
+
+type TotpCredential struct {
+	UserID       uuid.UUID
+	CreatedAt    time.Time
+	Secret       string
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
+}
+
+type User struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	EmailVerifiedAt     sql.NullTime
+	AvatarKey           sql.NullString
+	BannerKey           sql.NullString
+	Handle              sql.NullString
+	DisplayName         string
+	SuspendedUntil      sql.NullTime
+	Role                string
+	BannedAt            sql.NullTime
+	LastLoginAt         sql.NullTime
+	AllowDirectMessages bool
 }
@@ -10,69 +10,254 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-    token,
+    token_hash,
     created_at,
     updated_at,
     user_id,
     expires_at,
-    revoked_at
+    revoked_at,
+    family_id,
+    user_agent,
+    ip_address,
+    device_name,
+    last_used_at,
+    client_id,
+    scopes
 ) VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
     $3,
-    NULL
+    NULL,
+    $4,
+    $5,
+    $6,
+    $7,
+    NOW(),
+    $8,
+    $9
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip_address, device_name, last_used_at, client_id, scopes
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
-	UserID    uuid.UUID
-	ExpiresAt time.Time
+	TokenHash  string
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	FamilyID   uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	DeviceName string
+	ClientID   uuid.NullUUID
+	Scopes     []string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.DeviceName,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.DeviceName,
+		&i.LastUsedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
 
-const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT users.id FROM refresh_tokens
-INNER JOIN users on users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip_address, device_name, last_used_at, client_id, scopes FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenForUpdate, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.DeviceName,
+		&i.LastUsedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const getSessions = `-- name: GetSessions :many
+SELECT
+    refresh_tokens.family_id,
+    refresh_tokens.device_name,
+    refresh_tokens.user_agent,
+    refresh_tokens.ip_address,
+    (
+        SELECT MIN(first.created_at) FROM refresh_tokens AS first
+        WHERE first.family_id = refresh_tokens.family_id
+    )::timestamp AS signed_in_at,
+    refresh_tokens.last_used_at
+FROM refresh_tokens
+WHERE refresh_tokens.user_id = $1
 AND refresh_tokens.revoked_at IS NULL
+AND refresh_tokens.rotated_at IS NULL
 AND refresh_tokens.expires_at > NOW()
+ORDER BY refresh_tokens.last_used_at DESC
+`
+
+type GetSessionsRow struct {
+	FamilyID   uuid.UUID
+	DeviceName string
+	UserAgent  string
+	IpAddress  string
+	SignedInAt time.Time
+	LastUsedAt time.Time
+}
+
+func (q *Queries) GetSessions(ctx context.Context, userID uuid.UUID) ([]GetSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetSessionsRow
+	for rows.Next() {
+		var i GetSessionsRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.DeviceName,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.SignedInAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForUser, userID)
+	return err
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND family_id <> $2
+AND revoked_at IS NULL
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+type RevokeOtherSessionsParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOtherSessions, arg.UserID, arg.FamilyID)
+	return err
 }
 
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1
+WHERE token_hash = $1
+`
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, tokenHash)
+	return err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND user_id = $2
+AND revoked_at IS NULL
+AND expires_at > NOW()
+`
+
+type RevokeSessionParams struct {
+	FamilyID uuid.UUID
+	UserID   uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.FamilyID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :exec
+UPDATE refresh_tokens
+SET rotated_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RotateRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, rotateRefreshToken, tokenHash)
 	return err
 }
@@ -7,10 +7,80 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const autocompleteHandles = `-- name: AutocompleteHandles :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages FROM users
+WHERE handle ~>=~ $1::text
+AND handle ~<~ $2::text
+AND banned_at IS NULL
+AND (suspended_until IS NULL OR suspended_until < NOW())
+ORDER BY handle
+LIMIT $3
+`
+
+type AutocompleteHandlesParams struct {
+	LowerBound string
+	UpperBound string
+	MaxResults int32
+}
+
+func (q *Queries) AutocompleteHandles(ctx context.Context, arg AutocompleteHandlesParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, autocompleteHandles, arg.LowerBound, arg.UpperBound, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.EmailVerifiedAt,
+			&i.AvatarKey,
+			&i.BannerKey,
+			&i.Handle,
+			&i.DisplayName,
+			&i.SuspendedUntil,
+			&i.Role,
+			&i.BannedAt,
+			&i.LastLoginAt,
+			&i.AllowDirectMessages,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const banUser = `-- name: BanUser :exec
+UPDATE users SET
+    banned_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) BanUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, banUser, id)
+	return err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, is_chirpy_red, email, hashed_password)
 VALUES (
@@ -21,7 +91,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages
 `
 
 type CreateUserParams struct {
@@ -39,6 +109,16 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
 	)
 	return i, err
 }
@@ -65,7 +145,7 @@ func (q *Queries) EnableChirpyRed(ctx context.Context, id uuid.UUID) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users where email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages FROM users where email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -78,27 +158,576 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
+	)
+	return i, err
+}
+
+const getUsersByHandles = `-- name: GetUsersByHandles :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages FROM users
+WHERE handle = ANY($1::text[])
+`
+
+func (q *Queries) GetUsersByHandles(ctx context.Context, handles []string) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.EmailVerifiedAt,
+			&i.AvatarKey,
+			&i.BannerKey,
+			&i.Handle,
+			&i.DisplayName,
+			&i.SuspendedUntil,
+			&i.Role,
+			&i.BannedAt,
+			&i.LastLoginAt,
+			&i.AllowDirectMessages,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersForAdmin = `-- name: GetUsersForAdmin :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages FROM users
+WHERE (
+    $1::text IS NULL
+    OR email ILIKE '%' || $1::text || '%'
+    OR handle ILIKE '%' || $1::text || '%'
+)
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) < ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type GetUsersForAdminParams struct {
+	Pattern         sql.NullString
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	MaxResults      int32
+}
+
+func (q *Queries) GetUsersForAdmin(ctx context.Context, arg GetUsersForAdminParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersForAdmin,
+		arg.Pattern,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.EmailVerifiedAt,
+			&i.AvatarKey,
+			&i.BannerKey,
+			&i.Handle,
+			&i.DisplayName,
+			&i.SuspendedUntil,
+			&i.Role,
+			&i.BannedAt,
+			&i.LastLoginAt,
+			&i.AllowDirectMessages,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersRefusingDirectMessages = `-- name: GetUsersRefusingDirectMessages :many
+SELECT id FROM users
+WHERE id = ANY($1::uuid[])
+AND NOT allow_direct_messages
+`
+
+func (q *Queries) GetUsersRefusingDirectMessages(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersRefusingDirectMessages, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const promoteFirstAdmin = `-- name: PromoteFirstAdmin :one
+UPDATE users SET
+    role = 'admin',
+    updated_at = NOW()
+WHERE email = $1
+AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin')
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages
+`
+
+func (q *Queries) PromoteFirstAdmin(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, promoteFirstAdmin, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
 	)
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages FROM users
+WHERE handle IS NOT NULL
+AND (
+    handle ILIKE '%' || $1::text || '%'
+    OR display_name ILIKE '%' || $1::text || '%'
+)
+AND banned_at IS NULL
+AND (suspended_until IS NULL OR suspended_until < NOW())
+ORDER BY GREATEST(
+    similarity(handle, $2::text),
+    similarity(display_name, $2::text)
+) DESC, handle
+LIMIT $3
+`
+
+type SearchUsersParams struct {
+	Pattern    string
+	Query      string
+	MaxResults int32
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Pattern, arg.Query, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.EmailVerifiedAt,
+			&i.AvatarKey,
+			&i.BannerKey,
+			&i.Handle,
+			&i.DisplayName,
+			&i.SuspendedUntil,
+			&i.Role,
+			&i.BannedAt,
+			&i.LastLoginAt,
+			&i.AllowDirectMessages,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserEmailVerified = `-- name: SetUserEmailVerified :exec
+UPDATE users SET
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) SetUserEmailVerified(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, setUserEmailVerified, id)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users SET
+    role = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages
+`
+
+type SetUserRoleParams struct {
+	Role string
+	ID   uuid.UUID
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
+	)
+	return i, err
+}
+
+const suspendUser = `-- name: SuspendUser :exec
+UPDATE users SET
+    suspended_until = $1,
+    updated_at = NOW()
+WHERE id = $2
+`
+
+type SuspendUserParams struct {
+	SuspendedUntil sql.NullTime
+	ID             uuid.UUID
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) error {
+	_, err := q.db.ExecContext(ctx, suspendUser, arg.SuspendedUntil, arg.ID)
+	return err
+}
+
+const unbanUser = `-- name: UnbanUser :exec
+UPDATE users SET
+    banned_at = NULL,
+    suspended_until = NULL,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) UnbanUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, unbanUser, id)
+	return err
+}
+
+const updateLastLogin = `-- name: UpdateLastLogin :exec
+UPDATE users SET last_login_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) UpdateLastLogin(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, updateLastLogin, id)
+	return err
+}
+
+const updateUserAllowDirectMessages = `-- name: UpdateUserAllowDirectMessages :one
+UPDATE users SET
+    allow_direct_messages = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages
+`
+
+type UpdateUserAllowDirectMessagesParams struct {
+	AllowDirectMessages bool
+	ID                  uuid.UUID
+}
+
+func (q *Queries) UpdateUserAllowDirectMessages(ctx context.Context, arg UpdateUserAllowDirectMessagesParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserAllowDirectMessages, arg.AllowDirectMessages, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
+	)
+	return i, err
+}
+
+const updateUserAvatar = `-- name: UpdateUserAvatar :one
+UPDATE users SET
+    avatar_key = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages
+`
+
+type UpdateUserAvatarParams struct {
+	AvatarKey sql.NullString
+	ID        uuid.UUID
+}
+
+func (q *Queries) UpdateUserAvatar(ctx context.Context, arg UpdateUserAvatarParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserAvatar, arg.AvatarKey, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
+	)
+	return i, err
+}
+
+const updateUserBanner = `-- name: UpdateUserBanner :one
+UPDATE users SET
+    banner_key = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages
+`
+
+type UpdateUserBannerParams struct {
+	BannerKey sql.NullString
+	ID        uuid.UUID
+}
+
+func (q *Queries) UpdateUserBanner(ctx context.Context, arg UpdateUserBannerParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserBanner, arg.BannerKey, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
+	)
+	return i, err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
 UPDATE users SET
     email = $1,
-    hashed_password = $2,
+    email_verified_at = NULL,
     updated_at = NOW()
-WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages
 `
 
-type UpdateUserParams struct {
-	Email          string
+type UpdateUserEmailParams struct {
+	Email string
+	ID    uuid.UUID
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.Email, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users SET
+    hashed_password = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages
+`
+
+type UpdateUserPasswordParams struct {
 	HashedPassword string
 	ID             uuid.UUID
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users SET
+    handle = $1,
+    display_name = $2,
+    updated_at = NOW()
+WHERE id = $3
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, avatar_key, banner_key, handle, display_name, suspended_until, role, banned_at, last_login_at, allow_direct_messages
+`
+
+type UpdateUserProfileParams struct {
+	Handle      sql.NullString
+	DisplayName string
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile, arg.Handle, arg.DisplayName, arg.ID)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -107,6 +736,16 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.Handle,
+		&i.DisplayName,
+		&i.SuspendedUntil,
+		&i.Role,
+		&i.BannedAt,
+		&i.LastLoginAt,
+		&i.AllowDirectMessages,
 	)
 	return i, err
 }
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types published on the bus.
+const (
+	ChirpCreated        string = "chirp.created"
+	ChirpDeleted        string = "chirp.deleted"
+	UserUpgraded        string = "user.upgraded"
+	NotificationCreated string = "notification.created"
+	MessageCreated      string = "message.created"
+)
+
+// Event is something that happened on one instance that every instance may
+// need to react to. Audience, if not empty, lists the users it concerns.
+// The bus assigns the ID when the event is published; it is the same on
+// every instance and greater than that of every event delivered before.
+type Event struct {
+	ID       uint64          `json:"id"`
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data"`
+	Audience []uuid.UUID     `json:"audience,omitempty"`
+}
+
+// Handler is called for every event published on the bus.
+type Handler func(Event)
+
+// Bus delivers published events to the handlers subscribed on every
+// instance, including the one that published them. Delivery is at most
+// once: events published while an instance is disconnected are not
+// redelivered to it.
+type Bus interface {
+	Publish(ctx context.Context, event Event) error
+	Subscribe(handler Handler)
+	Close() error
+}
+
+type handlers struct {
+	mu   sync.RWMutex
+	list []Handler
+}
+
+func (h *handlers) Subscribe(handler Handler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.list = append(h.list, handler)
+}
+
+func (h *handlers) dispatch(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, handler := range h.list {
+		handler(event)
+	}
+}
+
+// Local is a Bus for a single instance. Handlers are called synchronously
+// from Publish.
+type Local struct {
+	handlers
+	mu     sync.Mutex
+	lastID uint64
+}
+
+// NewLocal returns a local bus. Its IDs start at the current time in
+// microseconds so that they keep increasing across restarts.
+func NewLocal() *Local {
+	return &Local{lastID: uint64(time.Now().UnixMicro())}
+}
+
+func (l *Local) Publish(ctx context.Context, event Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastID++
+	event.ID = l.lastID
+	l.dispatch(event)
+	return nil
+}
+
+func (l *Local) Close() error {
+	return nil
+}
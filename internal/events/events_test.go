@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLocalPublish(t *testing.T) {
+	bus := NewLocal()
+
+	var first, second []Event
+	bus.Subscribe(func(event Event) { first = append(first, event) })
+	bus.Subscribe(func(event Event) { second = append(second, event) })
+
+	event := Event{
+		Type:     ChirpCreated,
+		Data:     json.RawMessage(`{"id":"1"}`),
+		Audience: []uuid.UUID{uuid.New()},
+	}
+	if err := bus.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for _, received := range [][]Event{first, second} {
+		if len(received) != 1 || received[0].Type != ChirpCreated || string(received[0].Data) != `{"id":"1"}` {
+			t.Errorf("handler received %+v, want [%+v]", received, event)
+		}
+	}
+
+	if err := bus.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("handler received %d events, want 2", len(first))
+	}
+	if first[0].ID == 0 || first[1].ID <= first[0].ID {
+		t.Errorf("handler received IDs %d and %d, want increasing IDs", first[0].ID, first[1].ID)
+	}
+}
+
+func TestEventRoundTrip(t *testing.T) {
+	event := Event{
+		ID:       42,
+		Type:     MessageCreated,
+		Data:     json.RawMessage(`{"body":"hi"}`),
+		Audience: []uuid.UUID{uuid.New(), uuid.New()},
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded Event
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if decoded.ID != event.ID || decoded.Type != event.Type || string(decoded.Data) != string(event.Data) || len(decoded.Audience) != 2 || decoded.Audience[1] != event.Audience[1] {
+		t.Errorf("round trip = %+v, want %+v", decoded, event)
+	}
+}
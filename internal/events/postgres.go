@@ -0,0 +1,124 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const postgresChannel string = "chirpy_events"
+
+// publishLockKey, "chirpy" in ASCII, is the advisory lock that serializes
+// publishing.
+const publishLockKey int64 = 0x63686972707900
+
+// Postgres limits NOTIFY payloads to just under 8000 bytes.
+const maxPayloadBytes int = 7999
+
+const minReconnectInterval time.Duration = time.Second
+const maxReconnectInterval time.Duration = time.Minute
+const listenerPingInterval time.Duration = 90 * time.Second
+
+var ErrEventTooLarge = errors.New("Event is too large to publish")
+
+// Postgres is a Bus that fans events out to every instance connected to the
+// same database with LISTEN/NOTIFY. Events are published through db and
+// received on a dedicated connection opened with dataSource, which is
+// reestablished automatically if it drops.
+type Postgres struct {
+	handlers
+	db       *sql.DB
+	listener *pq.Listener
+}
+
+func NewPostgres(db *sql.DB, dataSource string) (*Postgres, error) {
+	listener := pq.NewListener(dataSource, minReconnectInterval, maxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Printf("Event bus disconnected: %s", err)
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("Event bus unable to reconnect: %s", err)
+		case pq.ListenerEventReconnected:
+			log.Print("Event bus reconnected, events published in the meantime were missed")
+		}
+	})
+	if err := listener.Listen(postgresChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	p := &Postgres{
+		db:       db,
+		listener: listener,
+	}
+	go p.run()
+	return p, nil
+}
+
+// Publish takes the event's ID from the event_ids sequence. Notifications
+// are delivered in the order their transactions commit, so publishing holds
+// a lock until then to make that the order of the IDs.
+func (p *Postgres) Publish(ctx context.Context, event Event) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", publishLockKey); err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT nextval('event_ids')").Scan(&event.ID); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayloadBytes {
+		return ErrEventTooLarge
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", postgresChannel, string(payload)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) Close() error {
+	return p.listener.Close()
+}
+
+func (p *Postgres) run() {
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case notification, ok := <-p.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification signals a reconnect.
+			if notification == nil {
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				log.Printf("Unable to decode event: %s", err)
+				continue
+			}
+			p.dispatch(event)
+		case <-ping.C:
+			// Pinging makes a silently dropped connection noticed and
+			// reestablished.
+			go p.listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+)
+
+var ErrUnsupportedFormat = errors.New("Unsupported image format")
+
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// Spec describes which uploads are accepted and what they are turned into.
+type Spec struct {
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+	Format    Format
+	Variants  []Variant
+}
+
+type Output struct {
+	Variant Variant
+	Data    []byte
+}
+
+func (f Format) Extension() string {
+	if f == FormatJPEG {
+		return "jpg"
+	}
+	return string(f)
+}
+
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Process decodes a PNG, JPEG or WebP image, checks its dimensions against
+// spec and re-encodes it once per variant. Each variant is center cropped to
+// its aspect ratio before scaling. Only pixel data survives re-encoding, so
+// EXIF and other metadata are stripped.
+func Process(r io.Reader, spec Spec) ([]Output, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	switch format {
+	case "png", "jpeg", "webp":
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if config.Width < spec.MinWidth || config.Height < spec.MinHeight {
+		return nil, fmt.Errorf("Image must be at least %dx%d pixels", spec.MinWidth, spec.MinHeight)
+	}
+	if config.Width > spec.MaxWidth || config.Height > spec.MaxHeight {
+		return nil, fmt.Errorf("Image must be at most %dx%d pixels", spec.MaxWidth, spec.MaxHeight)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	outputs := make([]Output, 0, len(spec.Variants))
+	for _, variant := range spec.Variants {
+		dst := image.NewRGBA(image.Rect(0, 0, variant.Width, variant.Height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, cropToAspect(src.Bounds(), variant.Width, variant.Height), draw.Src, nil)
+
+		var buf bytes.Buffer
+		switch spec.Format {
+		case FormatJPEG:
+			err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+		default:
+			err = png.Encode(&buf, dst)
+		}
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, Output{Variant: variant, Data: buf.Bytes()})
+	}
+	return outputs, nil
+}
+
+// cropToAspect returns the largest centered rectangle inside bounds that has
+// the aspect ratio width:height.
+func cropToAspect(bounds image.Rectangle, width, height int) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	if w*height > h*width {
+		cropped := h * width / height
+		x := bounds.Min.X + (w-cropped)/2
+		return image.Rect(x, bounds.Min.Y, x+cropped, bounds.Max.Y)
+	}
+	cropped := w * height / width
+	y := bounds.Min.Y + (h-cropped)/2
+	return image.Rect(bounds.Min.X, y, bounds.Max.X, y+cropped)
+}
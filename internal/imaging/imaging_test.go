@@ -0,0 +1,122 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	spec := Spec{
+		MinWidth:  100,
+		MinHeight: 100,
+		MaxWidth:  1000,
+		MaxHeight: 1000,
+		Format:    FormatJPEG,
+		Variants: []Variant{
+			{Name: "large", Width: 200, Height: 200},
+			{Name: "wide", Width: 90, Height: 30},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{
+			name:    "Valid image",
+			data:    encodePNG(t, 300, 150),
+			wantErr: false,
+		},
+		{
+			name:    "Too small",
+			data:    encodePNG(t, 50, 300),
+			wantErr: true,
+		},
+		{
+			name:    "Too large",
+			data:    encodePNG(t, 1200, 300),
+			wantErr: true,
+		},
+		{
+			name:    "Not an image",
+			data:    []byte("GIF89a definitely not an image"),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputs, err := Process(bytes.NewReader(test.data), spec)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Process() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if len(outputs) != len(spec.Variants) {
+				t.Fatalf("Process() returned %d outputs, want %d", len(outputs), len(spec.Variants))
+			}
+			for _, output := range outputs {
+				img, err := jpeg.Decode(bytes.NewReader(output.Data))
+				if err != nil {
+					t.Fatalf("jpeg.Decode() error = %v", err)
+				}
+				if img.Bounds().Dx() != output.Variant.Width || img.Bounds().Dy() != output.Variant.Height {
+					t.Errorf("variant %s is %v, want %dx%d", output.Variant.Name, img.Bounds(), output.Variant.Width, output.Variant.Height)
+				}
+			}
+		})
+	}
+}
+
+func TestCropToAspect(t *testing.T) {
+	tests := []struct {
+		name   string
+		bounds image.Rectangle
+		width  int
+		height int
+		want   image.Rectangle
+	}{
+		{
+			name:   "Wide source, square target",
+			bounds: image.Rect(0, 0, 300, 100),
+			width:  1,
+			height: 1,
+			want:   image.Rect(100, 0, 200, 100),
+		},
+		{
+			name:   "Tall source, wide target",
+			bounds: image.Rect(0, 0, 300, 900),
+			width:  3,
+			height: 1,
+			want:   image.Rect(0, 400, 300, 500),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := cropToAspect(test.bounds, test.width, test.height); got != test.want {
+				t.Errorf("cropToAspect() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SourceTwitter string = "twitter"
+	SourceChirpy  string = "chirpy"
+)
+
+var ErrUnknownArchive = errors.New("Archive is neither a Twitter/X archive nor a Chirpy export")
+
+var ErrFileTooLarge = errors.New("File in archive is too large")
+
+// maxFileSize caps how much of a file is decompressed, so that a small
+// archive cannot expand to fill the server's memory.
+var maxFileSize int64 = 256 << 20
+
+// Entry is a single post found in an archive. SourceID identifies it within
+// its source so that importing the same archive twice is harmless.
+type Entry struct {
+	SourceID  string
+	Body      string
+	CreatedAt time.Time
+}
+
+// twitterFiles are the names the tweets file has had in Twitter/X archives.
+var twitterFiles = []string{"data/tweets.js", "data/tweet.js"}
+
+const chirpyFile string = "chirps.json"
+
+// Read detects the kind of archive and returns its source and entries.
+func Read(r io.ReaderAt, size int64) (string, []Entry, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", nil, ErrUnknownArchive
+	}
+
+	for _, name := range twitterFiles {
+		if f := findFile(archive, name); f != nil {
+			entries, err := readTwitter(f)
+			return SourceTwitter, entries, err
+		}
+	}
+	if f := findFile(archive, chirpyFile); f != nil {
+		entries, err := readChirpy(f)
+		return SourceChirpy, entries, err
+	}
+	return "", nil, ErrUnknownArchive
+}
+
+func findFile(archive *zip.Reader, name string) *zip.File {
+	for _, f := range archive.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(maxFileSize) {
+		return nil, ErrFileTooLarge
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// The size in the header is only what the archive claims.
+	data, err := io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+	return data, nil
+}
+
+// readTwitter parses a tweets.js file, which is a JSON array assigned to a
+// JavaScript global such as window.YTD.tweets.part0.
+func readTwitter(f *zip.File) ([]Entry, error) {
+	type tweetFile []struct {
+		Tweet struct {
+			IDStr     string `json:"id_str"`
+			FullText  string `json:"full_text"`
+			CreatedAt string `json:"created_at"`
+		} `json:"tweet"`
+	}
+
+	data, err := readFile(f)
+	if err != nil {
+		return nil, err
+	}
+	start := strings.IndexByte(string(data), '[')
+	if start < 0 {
+		return nil, errors.New("Malformed tweets file")
+	}
+
+	var tweets tweetFile
+	if err := json.Unmarshal(data[start:], &tweets); err != nil {
+		return nil, errors.New("Malformed tweets file")
+	}
+
+	entries := make([]Entry, 0, len(tweets))
+	for _, t := range tweets {
+		createdAt, err := time.Parse(time.RubyDate, t.Tweet.CreatedAt)
+		if err != nil || t.Tweet.IDStr == "" {
+			return nil, errors.New("Malformed tweet in tweets file")
+		}
+		entries = append(entries, Entry{
+			SourceID:  t.Tweet.IDStr,
+			Body:      html.UnescapeString(t.Tweet.FullText),
+			CreatedAt: createdAt.UTC(),
+		})
+	}
+	return entries, nil
+}
+
+func readChirpy(f *zip.File) ([]Entry, error) {
+	type chirpFile []struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		Body      string    `json:"body"`
+	}
+
+	data, err := readFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var chirps chirpFile
+	if err := json.Unmarshal(data, &chirps); err != nil {
+		return nil, errors.New("Malformed chirps file")
+	}
+
+	entries := make([]Entry, 0, len(chirps))
+	for _, c := range chirps {
+		if c.ID == uuid.Nil {
+			return nil, errors.New("Malformed chirp in chirps file")
+		}
+		entries = append(entries, Entry{
+			SourceID:  c.ID.String(),
+			Body:      c.Body,
+			CreatedAt: c.CreatedAt.UTC(),
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func makeArchive(t *testing.T, files map[string]string) *bytes.Reader {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestRead(t *testing.T) {
+	tweets := `window.YTD.tweets.part0 = [
+  {"tweet": {"id_str": "1050118621198921728", "full_text": "Fish &amp; chips", "created_at": "Wed Oct 10 20:19:24 +0000 2018"}}
+]`
+	chirps := `[{"id": "0b6d1e5c-3a38-4d36-9a53-3a1f6d0d2c52", "created_at": "2024-10-01T12:00:00Z", "body": "Hello Chirpy", "user_id": "6f0e9c1e-8d35-4f7e-9c53-0b0d7e1f2a3b"}]`
+
+	tests := []struct {
+		name       string
+		files      map[string]string
+		wantSource string
+		wantEntry  Entry
+		wantErr    error
+	}{
+		{
+			name:       "Twitter archive",
+			files:      map[string]string{"data/tweets.js": tweets},
+			wantSource: SourceTwitter,
+			wantEntry: Entry{
+				SourceID:  "1050118621198921728",
+				Body:      "Fish & chips",
+				CreatedAt: time.Date(2018, 10, 10, 20, 19, 24, 0, time.UTC),
+			},
+		},
+		{
+			name:       "Chirpy export",
+			files:      map[string]string{"profile.json": "{}", "chirps.json": chirps},
+			wantSource: SourceChirpy,
+			wantEntry: Entry{
+				SourceID:  "0b6d1e5c-3a38-4d36-9a53-3a1f6d0d2c52",
+				Body:      "Hello Chirpy",
+				CreatedAt: time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "Unknown archive",
+			files:   map[string]string{"notes.txt": "hello"},
+			wantErr: ErrUnknownArchive,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := makeArchive(t, test.files)
+			source, entries, err := Read(r, r.Size())
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Read() error = %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if source != test.wantSource {
+				t.Errorf("Read() source = %q, want %q", source, test.wantSource)
+			}
+			if len(entries) != 1 || entries[0] != test.wantEntry {
+				t.Errorf("Read() entries = %+v, want [%+v]", entries, test.wantEntry)
+			}
+		})
+	}
+}
+
+func TestReadNotAZip(t *testing.T) {
+	r := bytes.NewReader([]byte("definitely not a zip"))
+	if _, _, err := Read(r, r.Size()); !errors.Is(err, ErrUnknownArchive) {
+		t.Errorf("Read() error = %v, want %v", err, ErrUnknownArchive)
+	}
+}
+
+func TestReadFileTooLarge(t *testing.T) {
+	defer func(size int64) { maxFileSize = size }(maxFileSize)
+	maxFileSize = 16
+
+	r := makeArchive(t, map[string]string{"chirps.json": `[{"body": "longer than sixteen bytes"}]`})
+	if _, _, err := Read(r, r.Size()); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Read() error = %v, want %v", err, ErrFileTooLarge)
+	}
+}
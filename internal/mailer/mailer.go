@@ -0,0 +1,194 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// bytes renders msg as a plain text RFC 5322 message.
+func (msg Message) bytes(from string) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, errors.New("Header contains a line break")
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
+
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	// fromAddress is the bare address of from, which is all the envelope
+	// may hold.
+	fromAddress string
+}
+
+// NewSMTPMailer returns a mailer that sends from the address from, which
+// may include a display name such as "Chirpy <no-reply@example.com>".
+func NewSMTPMailer(host, port, username, password, from string) (*SMTPMailer, error) {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid sender address %q: %w", from, err)
+	}
+	return &SMTPMailer{
+		host:        host,
+		port:        port,
+		username:    username,
+		password:    password,
+		from:        from,
+		fromAddress: addr.Address,
+	}, nil
+}
+
+// Send delivers msg through the SMTP server, upgrading to TLS if the server
+// offers it. It gives up when ctx is done, even in the middle of the
+// conversation with the server.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.bytes(m.from)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.host, m.port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	// Closing the connection unblocks whatever the client is waiting for.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.fromAddress); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// FileMailer writes every message to its own .eml file in a directory. It is
+// meant for local development.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.bytes(m.from)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewString())
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
+
+// MemoryMailer keeps sent messages in memory so tests can inspect them.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	if _, err := msg.bytes(""); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
@@ -0,0 +1,204 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		wantErr bool
+	}{
+		{
+			name:    "Valid message",
+			msg:     Message{To: "user@example.com", Subject: "Hello", Body: "Hi there"},
+			wantErr: false,
+		},
+		{
+			name:    "Line break in recipient",
+			msg:     Message{To: "user@example.com\r\nBcc: other@example.com", Subject: "Hello"},
+			wantErr: true,
+		},
+		{
+			name:    "Line break in subject",
+			msg:     Message{To: "user@example.com", Subject: "Hello\nBcc: other@example.com"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMemoryMailer()
+			err := m.Send(context.Background(), test.msg)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, test.wantErr)
+			}
+			wantMessages := 1
+			if test.wantErr {
+				wantMessages = 0
+			}
+			if got := len(m.Messages()); got != wantMessages {
+				t.Errorf("Messages() len = %d, want %d", got, wantMessages)
+			}
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileMailer(dir, "Chirpy <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("NewFileMailer() error = %v", err)
+	}
+
+	msg := Message{To: "user@example.com", Subject: "Hello", Body: "Line one\nLine two"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir() = %v, %v, want one file", entries, err)
+	}
+	data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	for _, want := range []string{"To: user@example.com\r\n", "Subject: Hello\r\n", "Line one\r\nLine two"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message does not contain %q", want)
+		}
+	}
+}
+
+// fakeSMTPServer accepts one connection and answers like an SMTP server
+// without extensions, returning the commands and message data it got.
+func fakeSMTPServer(t *testing.T) (string, string, <-chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []string, 1)
+	go func() {
+		var lines []string
+		defer func() { received <- lines }()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			lines = append(lines, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				text.PrintfLine("250 localhost")
+			case line == "DATA":
+				text.PrintfLine("354 Go ahead")
+				data, err := text.ReadDotLines()
+				if err != nil {
+					return
+				}
+				lines = append(lines, data...)
+				text.PrintfLine("250 OK")
+			case line == "QUIT":
+				text.PrintfLine("221 Bye")
+				return
+			default:
+				text.PrintfLine("250 OK")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return host, port, received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	m, err := NewSMTPMailer(host, port, "", "", "Chirpy <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+
+	msg := Message{To: "Some User <user@example.com>", Subject: "Hello", Body: "Hi there"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	lines := <-received
+	for _, want := range []string{
+		"MAIL FROM:<no-reply@example.com>",
+		"RCPT TO:<user@example.com>",
+		"From: Chirpy <no-reply@example.com>",
+		"To: Some User <user@example.com>",
+		"Hi there",
+	} {
+		found := false
+		for _, line := range lines {
+			found = found || strings.HasPrefix(line, want)
+		}
+		if !found {
+			t.Errorf("server did not receive %q, got %q", want, lines)
+		}
+	}
+}
+
+func TestNewSMTPMailerInvalidFrom(t *testing.T) {
+	if _, err := NewSMTPMailer("localhost", "25", "", "", "Chirpy"); err == nil {
+		t.Errorf("NewSMTPMailer() accepted a sender without an address")
+	}
+}
+
+func TestSMTPMailerCancel(t *testing.T) {
+	// A server that accepts connections but never greets the client.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	m, err := NewSMTPMailer(host, port, "", "", "no-reply@example.com")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Send(ctx, Message{To: "user@example.com", Subject: "Hello"})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Send() error = nil after the context expired")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Send() did not return after the context expired")
+	}
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocal(t.TempDir(), "/media/")
+	if err != nil {
+		t.Fatalf("NewLocal() error = %v", err)
+	}
+
+	if err := store.Put(ctx, "avatars/1/small.png", strings.NewReader("data")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	f, err := store.Open(ctx, "avatars/1/small.png")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "data" {
+		t.Errorf("Open() data = %q, want %q", data, "data")
+	}
+
+	if got := store.URL("avatars/1/small.png"); got != "/media/avatars/1/small.png" {
+		t.Errorf("URL() = %q", got)
+	}
+
+	if err := store.Delete(ctx, "avatars/1/small.png"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Open(ctx, "avatars/1/small.png"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open() after Delete() error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestLocalInvalidKeys(t *testing.T) {
+	store, err := NewLocal(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("NewLocal() error = %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../outside", "a//b"} {
+		t.Run(key, func(t *testing.T) {
+			if err := store.Put(context.Background(), key, strings.NewReader("data")); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+			}
+		})
+	}
+}
+
+func TestLocalHandler(t *testing.T) {
+	store, err := NewLocal(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("NewLocal() error = %v", err)
+	}
+	if err := store.Put(context.Background(), "avatars/1/small.png", strings.NewReader("data")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/avatars/1/small.png", http.StatusOK},
+		{"/avatars/1/missing.png", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+		{"/avatars/", http.StatusNotFound},
+		{"/avatars/1", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		store.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if rec.Code != test.wantStatus {
+			t.Errorf("GET %s status = %d, want %d", test.path, rec.Code, test.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Event is a message published to subscribers. IDs increase with every
+// published event, though not necessarily by one, so subscribers can resume
+// after the last ID they saw. Events with an Audience are private to those
+// users; it is up to the subscribers' filters to respect that.
+type Event struct {
+	ID       uint64
+	Type     string
+	Data     []byte
+	AuthorID uuid.UUID
+	Tags     []string
+	Audience []uuid.UUID
+}
+
+// Filter decides whether a subscriber receives an event.
+type Filter func(Event) bool
+
+// Broker fans published events out to subscribers and keeps the most recent
+// ones for replay.
+type Broker struct {
+	mu     sync.Mutex
+	lastID uint64
+	// Events up to floor may be missing from replay, because they were
+	// evicted or published before the broker received its first event.
+	floor       uint64
+	replay      []Event
+	replayStart int
+	replaySize  int
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events matching its filter. A subscriber that
+// falls more than the broker's buffer size behind is dropped: its channel
+// is closed and Dropped reports true. It can resubscribe from the last event
+// it received.
+type Subscription struct {
+	events  chan Event
+	filter  Filter
+	after   uint64
+	dropped bool
+}
+
+// NewBroker returns a broker that keeps replaySize events for replay and
+// buffers up to bufferSize events for each subscriber.
+func NewBroker(replaySize, bufferSize int) *Broker {
+	return &Broker{
+		replaySize:  replaySize,
+		bufferSize:  bufferSize,
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Publish delivers the event to every matching subscriber without
+// blocking. Events that already have an ID keep it, so that brokers on
+// several instances agree on IDs; it has to be greater than that of every
+// event published before, or the event is dropped. Events without an ID
+// are assigned the next one.
+func (b *Broker) Publish(event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.ID == 0 {
+		event.ID = b.lastID + 1
+	}
+	if event.ID <= b.lastID {
+		return event
+	}
+	if b.lastID == 0 {
+		b.floor = event.ID - 1
+	}
+	b.lastID = event.ID
+
+	if len(b.replay) < b.replaySize {
+		b.replay = append(b.replay, event)
+	} else if b.replaySize > 0 {
+		b.floor = b.replay[b.replayStart].ID
+		b.replay[b.replayStart] = event
+		b.replayStart = (b.replayStart + 1) % b.replaySize
+	} else {
+		b.floor = event.ID
+	}
+
+	for sub := range b.subscribers {
+		if event.ID <= sub.after || (sub.filter != nil && !sub.filter(event)) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped = true
+			close(sub.events)
+			delete(b.subscribers, sub)
+		}
+	}
+	return event
+}
+
+// Subscribe registers a subscriber. If lastID is not zero, the matching
+// events published after it are returned for replay; complete is false when
+// some of them are not in the replay buffer, in which case nothing is
+// replayed and the subscriber has to catch up some other way. A lastID
+// ahead of the broker, seen on another instance that received events
+// sooner, is fine: events up to it are skipped when they arrive.
+func (b *Broker) Subscribe(lastID uint64, filter Filter) (sub *Subscription, missed []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{
+		events: make(chan Event, b.bufferSize),
+		filter: filter,
+		after:  lastID,
+	}
+	b.subscribers[sub] = struct{}{}
+
+	if lastID == 0 {
+		return sub, nil, true
+	}
+	if b.lastID == 0 || lastID < b.floor {
+		return sub, nil, false
+	}
+	if lastID >= b.lastID {
+		return sub, nil, true
+	}
+	for i := range b.replay {
+		event := b.replay[(b.replayStart+i)%len(b.replay)]
+		if event.ID > lastID && (filter == nil || filter(event)) {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, true
+}
+
+// Unsubscribe removes the subscriber and closes its channel.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		close(sub.events)
+		delete(b.subscribers, sub)
+	}
+}
+
+// Events returns the channel events are delivered on.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped reports whether the subscription was closed because the
+// subscriber fell behind. It is only meaningful once Events is closed.
+func (s *Subscription) Dropped() bool {
+	return s.dropped
+}
+
+// WriteEvent writes event in the Server-Sent Events wire format.
+func WriteEvent(w io.Writer, event Event) error {
+	var sb strings.Builder
+	if event.ID != 0 {
+		fmt.Fprintf(&sb, "id: %d\n", event.ID)
+	}
+	if event.Type != "" {
+		fmt.Fprintf(&sb, "event: %s\n", event.Type)
+	}
+	for _, line := range strings.Split(string(event.Data), "\n") {
+		fmt.Fprintf(&sb, "data: %s\n", line)
+	}
+	sb.WriteString("\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
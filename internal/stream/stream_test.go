@@ -0,0 +1,206 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func publishN(b *Broker, n int) {
+	for i := 0; i < n; i++ {
+		b.Publish(Event{Type: "chirp", Data: []byte("{}")})
+	}
+}
+
+func eventIDs(events []Event) []uint64 {
+	ids := []uint64{}
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	tests := []struct {
+		name         string
+		lastID       uint64
+		wantIDs      []uint64
+		wantComplete bool
+	}{
+		{
+			name:         "New subscriber",
+			lastID:       0,
+			wantIDs:      []uint64{},
+			wantComplete: true,
+		},
+		{
+			name:         "Up to date",
+			lastID:       5,
+			wantIDs:      []uint64{},
+			wantComplete: true,
+		},
+		{
+			name:         "Missed events in buffer",
+			lastID:       2,
+			wantIDs:      []uint64{3, 4, 5},
+			wantComplete: true,
+		},
+		{
+			name:         "Missed events evicted",
+			lastID:       1,
+			wantIDs:      []uint64{},
+			wantComplete: false,
+		},
+		{
+			name:         "Ahead of this broker",
+			lastID:       42,
+			wantIDs:      []uint64{},
+			wantComplete: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewBroker(3, 10)
+			publishN(b, 5)
+
+			_, missed, complete := b.Subscribe(test.lastID, nil)
+			if complete != test.wantComplete {
+				t.Errorf("Subscribe() complete = %v, want %v", complete, test.wantComplete)
+			}
+			if got := eventIDs(missed); !equalIDs(got, test.wantIDs) {
+				t.Errorf("Subscribe() missed = %v, want %v", got, test.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSharedIDs(t *testing.T) {
+	b := NewBroker(3, 10)
+	for _, id := range []uint64{100, 104, 107} {
+		b.Publish(Event{ID: id, Type: "chirp"})
+	}
+
+	tests := []struct {
+		name         string
+		lastID       uint64
+		wantIDs      []uint64
+		wantComplete bool
+	}{
+		{"Missed events in buffer", 102, []uint64{104, 107}, true},
+		{"Before the first event received", 98, []uint64{}, false},
+		{"Just before the first event received", 99, []uint64{100, 104, 107}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, missed, complete := b.Subscribe(test.lastID, nil)
+			if complete != test.wantComplete {
+				t.Errorf("Subscribe() complete = %v, want %v", complete, test.wantComplete)
+			}
+			if got := eventIDs(missed); !equalIDs(got, test.wantIDs) {
+				t.Errorf("Subscribe() missed = %v, want %v", got, test.wantIDs)
+			}
+		})
+	}
+
+	b.Publish(Event{ID: 105, Type: "chirp"})
+	if _, missed, _ := b.Subscribe(104, nil); !equalIDs(eventIDs(missed), []uint64{107}) {
+		t.Errorf("Subscribe() missed = %v, want [107] without the out-of-order event", eventIDs(missed))
+	}
+}
+
+func TestSubscribeAhead(t *testing.T) {
+	b := NewBroker(10, 10)
+	b.Publish(Event{ID: 5, Type: "chirp"})
+
+	// The subscriber saw up to 7 on another instance.
+	sub, missed, complete := b.Subscribe(7, nil)
+	if !complete || len(missed) != 0 {
+		t.Fatalf("Subscribe() = %v, %v, want nothing missed", missed, complete)
+	}
+
+	b.Publish(Event{ID: 6, Type: "chirp"})
+	b.Publish(Event{ID: 7, Type: "chirp"})
+	b.Publish(Event{ID: 8, Type: "chirp"})
+
+	event := <-sub.Events()
+	if event.ID != 8 {
+		t.Errorf("Events() ID = %d, want 8", event.ID)
+	}
+}
+
+func TestSubscribeBeforeFirstEvent(t *testing.T) {
+	b := NewBroker(10, 10)
+	if _, _, complete := b.Subscribe(3, nil); complete {
+		t.Error("Subscribe() complete = true before any event was received")
+	}
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPublishFilter(t *testing.T) {
+	author := uuid.New()
+	b := NewBroker(10, 10)
+	sub, _, _ := b.Subscribe(0, func(event Event) bool {
+		return event.AuthorID == author
+	})
+
+	b.Publish(Event{Type: "chirp", AuthorID: uuid.New()})
+	b.Publish(Event{Type: "chirp", AuthorID: author})
+
+	event := <-sub.Events()
+	if event.ID != 2 {
+		t.Errorf("Events() ID = %d, want 2", event.ID)
+	}
+	select {
+	case event := <-sub.Events():
+		t.Errorf("Events() delivered unexpected event %d", event.ID)
+	default:
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker(10, 2)
+	sub, _, _ := b.Subscribe(0, nil)
+
+	publishN(b, 3)
+
+	received := 0
+	for range sub.Events() {
+		received++
+	}
+	if received != 2 {
+		t.Errorf("received %d events, want 2", received)
+	}
+	if !sub.Dropped() {
+		t.Error("Dropped() = false, want true")
+	}
+
+	// Unsubscribing a dropped subscriber must not close its channel twice.
+	b.Unsubscribe(sub)
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteEvent(&buf, Event{ID: 7, Type: "chirp", Data: []byte("{\"a\":1}\n{\"b\":2}")})
+	if err != nil {
+		t.Fatalf("WriteEvent() error = %v", err)
+	}
+
+	want := "id: 7\nevent: chirp\ndata: {\"a\":1}\ndata: {\"b\":2}\n\n"
+	if buf.String() != want {
+		t.Errorf("WriteEvent() = %q, want %q", buf.String(), want)
+	}
+}
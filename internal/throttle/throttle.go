@@ -0,0 +1,50 @@
+// Package throttle computes how long failed attempts, such as logins with a
+// wrong password, hold off further attempts. It keeps no state: callers
+// count the failures and pass in the time.
+package throttle
+
+import "time"
+
+// Policy describes how failures slow down further attempts. After
+// FreeAttempts failures, every failure delays the next attempt by twice as
+// long as the one before, starting at BaseDelay and capped at MaxDelay.
+// Once LockoutAfter failures are reached, attempts are refused for
+// LockoutDuration after each further failure.
+type Policy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+}
+
+// Delay returns how long after the last of failures the next attempt is
+// allowed.
+func (p Policy) Delay(failures int) time.Duration {
+	if p.LockedOut(failures) {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for range failures - p.FreeAttempts - 1 {
+		if delay >= p.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// LockedOut reports whether failures are enough for a lockout.
+func (p Policy) LockedOut(failures int) bool {
+	return p.LockoutAfter > 0 && failures >= p.LockoutAfter
+}
+
+// RetryAfter returns how long from now the next attempt has to wait, or 0
+// if it is allowed.
+func (p Policy) RetryAfter(failures int, lastFailedAt, now time.Time) time.Duration {
+	return max(lastFailedAt.Add(p.Delay(failures)).Sub(now), 0)
+}
@@ -0,0 +1,73 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        10 * time.Second,
+	LockoutAfter:    10,
+	LockoutDuration: time.Hour,
+}
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{9, 10 * time.Second},
+		{10, time.Hour},
+		{1000, time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := testPolicy.Delay(test.failures); got != test.want {
+			t.Errorf("Delay(%d) = %s, want %s", test.failures, got, test.want)
+		}
+	}
+}
+
+func TestDelayWithoutLockout(t *testing.T) {
+	policy := testPolicy
+	policy.LockoutAfter = 0
+
+	if got := policy.Delay(1000); got != policy.MaxDelay {
+		t.Errorf("Delay(1000) = %s, want %s", got, policy.MaxDelay)
+	}
+	if policy.LockedOut(1000) {
+		t.Errorf("LockedOut(1000) = true without a lockout")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	lastFailedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		failures int
+		now      time.Time
+		want     time.Duration
+	}{
+		{"free attempt", 3, lastFailedAt, 0},
+		{"waiting", 5, lastFailedAt.Add(500 * time.Millisecond), 1500 * time.Millisecond},
+		{"waited", 5, lastFailedAt.Add(2 * time.Second), 0},
+		{"long ago", 5, lastFailedAt.Add(time.Hour), 0},
+		{"locked out", 10, lastFailedAt.Add(time.Minute), 59 * time.Minute},
+	}
+
+	for _, test := range tests {
+		if got := testPolicy.RetryAfter(test.failures, lastFailedAt, test.now); got != test.want {
+			t.Errorf("%s: RetryAfter() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Package totp implements time-based one-time passwords (RFC 6238) the way
+// authenticator apps expect them: HMAC-SHA1, 30 second steps and 6 digits.
+//
+// Nothing in the package reads the clock. Callers pass the current time in,
+// so codes can be checked against any point in time.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Period time.Duration = 30 * time.Second
+	Digits int           = 6
+
+	// skew is the number of steps before and after the current one whose
+	// codes are accepted as well, to allow for clocks that are slightly off.
+	skew int64 = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random 160 bit secret, base32 encoded.
+func GenerateSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(key), nil
+}
+
+// URI returns the otpauth URI for secret that authenticator apps read from
+// a QR code.
+func URI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// Step returns the number of the time step t falls in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code for secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, Step(t), Digits), nil
+}
+
+// Validate checks code against the codes for secret around time t and
+// returns the step of the code that matched. Codes from steps up to and
+// including lastStep are rejected, so that storing the returned step as the
+// next lastStep makes every code single-use.
+func Validate(secret, code string, t time.Time, lastStep int64) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for step := current - skew; step <= current+skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step, Digits)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// hotp computes the HOTP value (RFC 4226) of key for counter.
+func hotp(key []byte, counter int64, digits int) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulus := uint32(1)
+	for range digits {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%modulus)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.TrimRight(secret, "="))
+	return encoding.DecodeString(secret)
+}
@@ -0,0 +1,100 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestHOTPVectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, test := range tests {
+		if got := hotp(rfcSecret, Step(time.Unix(test.unix, 0)), 8); got != test.want {
+			t.Errorf("hotp() at %d = %s, want %s", test.unix, got, test.want)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString(rfcSecret)
+	got, err := Code(secret, time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("Code() error = %v", err)
+	}
+	if got != "287082" {
+		t.Errorf("Code() = %s, want 287082", got)
+	}
+
+	if _, err := Code("not base32!", time.Unix(59, 0)); err == nil {
+		t.Errorf("Code() accepted an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 10, 0, time.UTC)
+	current := Step(now)
+	code := func(t time.Time) string {
+		c, _ := Code(secret, t)
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"Current code", code(now), 0, current, true},
+		{"Previous step", code(now.Add(-Period)), 0, current - 1, true},
+		{"Next step", code(now.Add(Period)), 0, current + 1, true},
+		{"Too old", code(now.Add(-2 * Period)), 0, 0, false},
+		{"Too new", code(now.Add(2 * Period)), 0, 0, false},
+		{"Already used", code(now), current, 0, false},
+		{"Earlier step after later use", code(now.Add(-Period)), current, 0, false},
+		{"Wrong length", code(now)[:Digits-1], 0, 0, false},
+		{"Empty", "", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := Validate(secret, test.code, now, test.lastStep)
+			if ok != test.wantOK || step != test.wantStep {
+				t.Errorf("Validate() = %d, %v, want %d, %v", step, ok, test.wantStep, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Chirpy", "walt@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Chirpy:walt@example.com" {
+		t.Errorf("URI() = %s, want otpauth://totp/Chirpy:walt@example.com", uri)
+	}
+	query := uri.Query()
+	if query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("issuer") != "Chirpy" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("URI() query = %v", query)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+
+	"example.com/chirpy/internal/auth"
+)
+
+// handlerJWKS publishes the public keys access tokens are signed with, so
+// that other services can verify them without sharing a secret.
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Keys []auth.JWK `json:"keys"`
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJson(w, http.StatusOK, response{Keys: cfg.jwtKeys.JWKS()})
+}
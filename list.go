@@ -0,0 +1,536 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxListNameLength int = 25
+const maxListDescriptionLength int = 100
+
+// Limits on lists, which are higher for Chirpy Red users. Member limits
+// depend on the status of the list's owner.
+const (
+	maxListsPerUser      int64 = 10
+	maxListsPerRedUser   int64 = 50
+	maxListMembers       int64 = 50
+	maxListMembersForRed int64 = 500
+)
+
+const defaultTimelinePageSize int = 20
+const maxTimelinePageSize int = 100
+
+type list struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	OwnerID     uuid.UUID `json:"owner_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IsPrivate   bool      `json:"is_private"`
+}
+
+func listFromDatabase(dbList database.List) list {
+	return list{
+		ID:          dbList.ID,
+		CreatedAt:   dbList.CreatedAt,
+		UpdatedAt:   dbList.UpdatedAt,
+		OwnerID:     dbList.OwnerID,
+		Name:        dbList.Name,
+		Description: dbList.Description,
+		IsPrivate:   dbList.IsPrivate,
+	}
+}
+
+func listsFromDatabase(dbLists []database.List) []list {
+	lists := []list{}
+	for _, dbList := range dbLists {
+		lists = append(lists, listFromDatabase(dbList))
+	}
+	return lists
+}
+
+func normalizeListName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxListNameLength {
+		return "", fmt.Errorf("List name must be between 1 and %d characters", maxListNameLength)
+	}
+	return name, nil
+}
+
+func normalizeListDescription(description string) (string, error) {
+	description = strings.TrimSpace(description)
+	if utf8.RuneCountInString(description) > maxListDescriptionLength {
+		return "", fmt.Errorf("List description must be at most %d characters", maxListDescriptionLength)
+	}
+	return description, nil
+}
+
+// visibleList fetches the list in the path if userId may see it, writing a
+// 404 otherwise. Private lists are only visible to their owner.
+func (cfg *apiConfig) visibleList(w http.ResponseWriter, r *http.Request, userId uuid.UUID) (database.List, bool) {
+	listId, err := uuid.Parse(r.PathValue("listID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return database.List{}, false
+	}
+
+	dbList, err := cfg.dbQueries.GetList(r.Context(), listId)
+	if err != nil || (dbList.IsPrivate && dbList.OwnerID != userId) {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return database.List{}, false
+	}
+	return dbList, true
+}
+
+// ownedList fetches the list in the path if userId owns it, writing an error
+// otherwise.
+func (cfg *apiConfig) ownedList(w http.ResponseWriter, r *http.Request, userId uuid.UUID) (database.List, bool) {
+	dbList, ok := cfg.visibleList(w, r, userId)
+	if !ok {
+		return database.List{}, false
+	}
+	if dbList.OwnerID != userId {
+		respondWithError(w, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return database.List{}, false
+	}
+	return dbList, true
+}
+
+func (cfg *apiConfig) handlerCreateList(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		IsPrivate   bool   `json:"is_private"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	name, err := normalizeListName(params.Name)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	description, err := normalizeListDescription(params.Description)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	count, err := cfg.dbQueries.CountListsByOwner(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to count lists: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	limit := maxListsPerUser
+	if dbUser.IsChirpyRed {
+		limit = maxListsPerRedUser
+	}
+	if count >= limit {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("You can have at most %d lists", limit))
+		return
+	}
+
+	dbList, err := cfg.dbQueries.CreateList(r.Context(), database.CreateListParams{
+		OwnerID:     userId,
+		Name:        name,
+		Description: description,
+		IsPrivate:   params.IsPrivate,
+	})
+	if err != nil {
+		log.Printf("Unable to create list: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, listFromDatabase(dbList))
+}
+
+func (cfg *apiConfig) handlerGetLists(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbLists, err := cfg.dbQueries.GetListsByOwner(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch lists: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, listsFromDatabase(dbLists))
+}
+
+func (cfg *apiConfig) handlerGetSubscribedLists(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbLists, err := cfg.dbQueries.GetSubscribedLists(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch subscribed lists: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, listsFromDatabase(dbLists))
+}
+
+func (cfg *apiConfig) handlerGetList(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbList, ok := cfg.visibleList(w, r, userId)
+	if !ok {
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, listFromDatabase(dbList))
+}
+
+// handlerUpdateList changes the fields given. Making a list private drops
+// its subscribers.
+func (cfg *apiConfig) handlerUpdateList(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		IsPrivate   *bool   `json:"is_private"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	dbList, ok := cfg.ownedList(w, r, userId)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	update := database.UpdateListParams{
+		Name:        dbList.Name,
+		Description: dbList.Description,
+		IsPrivate:   dbList.IsPrivate,
+		ID:          dbList.ID,
+	}
+	var err error
+	if params.Name != nil {
+		update.Name, err = normalizeListName(*params.Name)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if params.Description != nil {
+		update.Description, err = normalizeListDescription(*params.Description)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if params.IsPrivate != nil {
+		update.IsPrivate = *params.IsPrivate
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	updated, err := qtx.UpdateList(r.Context(), update)
+	if err != nil {
+		log.Printf("Unable to update list: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if updated.IsPrivate && !dbList.IsPrivate {
+		if err := qtx.DeleteListSubscriptions(r.Context(), dbList.ID); err != nil {
+			log.Printf("Unable to delete list subscriptions: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit list update: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, listFromDatabase(updated))
+}
+
+func (cfg *apiConfig) handlerDeleteList(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbList, ok := cfg.ownedList(w, r, userId)
+	if !ok {
+		return
+	}
+
+	if err := cfg.dbQueries.DeleteList(r.Context(), dbList.ID); err != nil {
+		log.Printf("Unable to delete list: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetListMembers(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbList, ok := cfg.visibleList(w, r, userId)
+	if !ok {
+		return
+	}
+
+	dbUsers, err := cfg.dbQueries.GetListMembers(r.Context(), dbList.ID)
+	if err != nil {
+		log.Printf("Unable to fetch list members: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	members := []profile{}
+	for _, dbUser := range dbUsers {
+		members = append(members, cfg.profileFromDatabase(dbUser))
+	}
+
+	respondWithJson(w, http.StatusOK, members)
+}
+
+// handlerAddListMember adds the user in the path to the list. Adding a user
+// who is already a member does nothing.
+func (cfg *apiConfig) handlerAddListMember(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbList, ok := cfg.ownedList(w, r, userId)
+	if !ok {
+		return
+	}
+
+	memberId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if _, err := cfg.dbQueries.GetUserByID(r.Context(), memberId); err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	isMember, err := cfg.dbQueries.IsListMember(r.Context(), database.IsListMemberParams{
+		ListID: dbList.ID,
+		UserID: memberId,
+	})
+	if err != nil {
+		log.Printf("Unable to check list membership: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if isMember {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	owner, err := cfg.dbQueries.GetUserByID(r.Context(), dbList.OwnerID)
+	if err != nil {
+		log.Printf("Unable to fetch list owner: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	count, err := cfg.dbQueries.CountListMembers(r.Context(), dbList.ID)
+	if err != nil {
+		log.Printf("Unable to count list members: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	limit := maxListMembers
+	if owner.IsChirpyRed {
+		limit = maxListMembersForRed
+	}
+	if count >= limit {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("Lists can have at most %d members", limit))
+		return
+	}
+
+	if err := cfg.dbQueries.AddListMember(r.Context(), database.AddListMemberParams{
+		ListID: dbList.ID,
+		UserID: memberId,
+	}); err != nil {
+		log.Printf("Unable to add list member: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerRemoveListMember(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbList, ok := cfg.ownedList(w, r, userId)
+	if !ok {
+		return
+	}
+
+	memberId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if err := cfg.dbQueries.RemoveListMember(r.Context(), database.RemoveListMemberParams{
+		ListID: dbList.ID,
+		UserID: memberId,
+	}); err != nil {
+		log.Printf("Unable to remove list member: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerSubscribeToList(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbList, ok := cfg.visibleList(w, r, userId)
+	if !ok {
+		return
+	}
+	if dbList.OwnerID == userId {
+		respondWithError(w, http.StatusBadRequest, "You cannot subscribe to your own list")
+		return
+	}
+
+	if err := cfg.dbQueries.SubscribeToList(r.Context(), database.SubscribeToListParams{
+		ListID: dbList.ID,
+		UserID: userId,
+	}); err != nil {
+		log.Printf("Unable to subscribe to list: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnsubscribeFromList(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	listId, err := uuid.Parse(r.PathValue("listID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if err := cfg.dbQueries.UnsubscribeFromList(r.Context(), database.UnsubscribeFromListParams{
+		ListID: listId,
+		UserID: userId,
+	}); err != nil {
+		log.Printf("Unable to unsubscribe from list: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerGetListTimeline returns chirps by the list's members, newest first.
+// Older pages are fetched by passing the ID of the last chirp received as
+// before.
+func (cfg *apiConfig) handlerGetListTimeline(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Chirps     []chirp    `json:"chirps"`
+		NextBefore *uuid.UUID `json:"next_before"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	dbList, ok := cfg.visibleList(w, r, userId)
+	if !ok {
+		return
+	}
+
+	limit := defaultTimelinePageSize
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(parsed, maxTimelinePageSize)
+	}
+
+	params := database.GetListTimelineParams{
+		ListID:     dbList.ID,
+		MaxResults: int32(limit),
+	}
+	if beforeParam := r.URL.Query().Get("before"); beforeParam != "" {
+		beforeId, err := uuid.Parse(beforeParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid before cursor")
+			return
+		}
+		before, err := cfg.dbQueries.GetChirp(r.Context(), beforeId)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid before cursor")
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to fetch chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: before.CreatedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: before.ID, Valid: true}
+	}
+
+	dbChirps, err := cfg.dbQueries.GetListTimeline(r.Context(), params)
+	if err != nil {
+		log.Printf("Unable to fetch list timeline: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	resp := response{Chirps: []chirp{}}
+	for _, dbChirp := range dbChirps {
+		resp.Chirps = append(resp.Chirps, chirpFromDatabase(dbChirp))
+	}
+	if len(dbChirps) == limit {
+		resp.NextBefore = &dbChirps[len(dbChirps)-1].ID
+	}
+
+	respondWithJson(w, http.StatusOK, resp)
+}
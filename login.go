@@ -1,24 +1,36 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"time"
 
 	"example.com/chirpy/internal/auth"
 	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
+type loginResponse struct {
+	user
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// challengeResponse is the response to a correct password for an account
+// with two-factor authentication.
+type challengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
-	}
-	type response struct {
-		user
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
+		Password   string `json:"password"`
+		Email      string `json:"email"`
+		DeviceName string `json:"device_name"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -29,50 +41,139 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dbUser, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
+	// Throttled logins are refused before the password is checked, so that
+	// guessing cannot keep the server busy with bcrypt.
+	attempt, wait, err := cfg.startLoginAttempt(r, params.Email)
 	if err != nil {
+		log.Printf("Unable to start login attempt: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if wait > 0 {
+		respondTooManyLoginAttempts(w, wait)
+		return
+	}
+
+	// An unknown email and a wrong password get the same response after the
+	// same time, so that logins do not reveal which emails are registered.
+	dbUser, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Printf("Error querying user by email: %s", err)
 		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
+	found := err == nil
 
-	if err := auth.CheckPasswordHash(params.Password, dbUser.HashedPassword); err != nil {
-		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+	var passwordErr error
+	if found {
+		passwordErr = auth.CheckPasswordHash(params.Password, dbUser.HashedPassword)
+	} else {
+		passwordErr = auth.CheckNoPasswordHash(params.Password)
+	}
+	if passwordErr != nil {
+		var failedUser *database.User
+		if found {
+			failedUser = &dbUser
+		}
+		cfg.failLoginAttempt(r, attempt, failedUser)
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(dbUser.ID, cfg.jwtSecret, accessTokenExpiresIn)
-	if err != nil {
-		log.Printf("Unable to create access token: %s", err)
+	// A correct password is not a failure, but with two-factor
+	// authentication the account's failures are only cleared once the code
+	// is right too.
+	if err := cfg.passLoginAttempt(r, attempt); err != nil {
+		log.Printf("Unable to pass login attempt: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if restriction := accountRestriction(dbUser); restriction != "" {
+		respondWithError(w, http.StatusForbidden, restriction)
+		return
+	}
+
+	if len(params.DeviceName) > maxDeviceNameLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Device name must be at most %d characters", maxDeviceNameLength))
+		return
+	}
+
+	// With two-factor authentication enabled the password only earns a
+	// challenge token, which POST /api/login/2fa exchanges for the session
+	// together with a code.
+	credential, err := cfg.dbQueries.GetTOTPCredential(r.Context(), dbUser.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Unable to fetch TOTP credential: %s", err)
 		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
+	if err == nil && credential.ConfirmedAt.Valid {
+		challengeToken, err := auth.MakeRandomToken()
+		if err != nil {
+			log.Printf("Unable to create login challenge: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := cfg.dbQueries.CreateLoginChallenge(r.Context(), database.CreateLoginChallengeParams{
+			TokenHash:  auth.HashToken(challengeToken),
+			UserID:     dbUser.ID,
+			DeviceName: params.DeviceName,
+			ExpiresAt:  cfg.now().UTC().Add(loginChallengeExpiresIn),
+		}); err != nil {
+			log.Printf("Unable to store login challenge: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
 
-	refreshToken, err := auth.MakeRefreshToken()
+		respondWithJson(w, http.StatusOK, challengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+		return
+	}
+
+	cfg.finishLogin(w, r, dbUser, params.DeviceName)
+}
+
+// finishLogin starts a session for a user who has proven who they are and
+// responds with its tokens.
+func (cfg *apiConfig) finishLogin(w http.ResponseWriter, r *http.Request, dbUser database.User, deviceName string) {
+	if err := cfg.clearLoginFailures(r, dbUser.Email); err != nil {
+		log.Printf("Unable to clear login failures: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	// Each login starts a session: a family of refresh tokens that the
+	// access tokens issued for it refer to.
+	sessionId := uuid.New()
+	refreshToken, err := issueRefreshToken(r, cfg.dbQueries, dbUser.ID, sessionId, deviceName)
 	if err != nil {
 		log.Printf("Unable to create refresh token: %s", err)
 		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	if _, err := cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
+	accessToken, err := auth.MakeJWT(auth.Claims{
 		UserID:    dbUser.ID,
-		ExpiresAt: time.Now().UTC().Add(refreshTokenExpiresIn),
-	}); err != nil {
-		log.Printf("Unable to create refresh token: %s", err)
+		Role:      dbUser.Role,
+		SessionID: sessionId,
+	}, cfg.jwtKeys, accessTokenExpiresIn)
+	if err != nil {
+		log.Printf("Unable to create access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := cfg.dbQueries.UpdateLastLogin(r.Context(), dbUser.ID); err != nil {
+		log.Printf("Unable to record login: %s", err)
 		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	respondWithJson(w, http.StatusOK, response{
-		user: user{
-			ID:          dbUser.ID,
-			CreatedAt:   dbUser.CreatedAt,
-			UpdatedAt:   dbUser.UpdatedAt,
-			Email:       dbUser.Email,
-			IsChirpyRed: dbUser.IsChirpyRed,
-		},
+	respondWithJson(w, http.StatusOK, loginResponse{
+		user:         cfg.userFromDatabase(dbUser),
 		Token:        accessToken,
 		RefreshToken: refreshToken,
 	})
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/mailer"
+	"example.com/chirpy/internal/throttle"
+)
+
+// loginFailureWindow is how long failed logins are remembered after the
+// last one.
+const loginFailureWindow time.Duration = 24 * time.Hour
+
+// accountLoginPolicy slows down guessing the password of one account,
+// whether or not an account exists for the email.
+var accountLoginPolicy = throttle.Policy{
+	FreeAttempts:    5,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    15,
+	LockoutDuration: 30 * time.Minute,
+}
+
+// ipLoginPolicy slows down guessing passwords of many accounts from one
+// address. It is more lenient since many users can share an address.
+var ipLoginPolicy = throttle.Policy{
+	FreeAttempts:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    100,
+	LockoutDuration: time.Hour,
+}
+
+func accountLoginKey(email string) string {
+	return "email:" + email
+}
+
+func ipLoginKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// loginAttempt is an attempt to sign in, counted as failed from the start
+// so that concurrent attempts cannot all pass the throttle before any of
+// them fails.
+type loginAttempt struct {
+	accountKey string
+	ipKey      string
+	// accountFailures includes this attempt.
+	accountFailures int32
+}
+
+// startLoginAttempt checks whether a login to the account with email may be
+// attempted from the address of r, and if so counts it as a failure until
+// passLoginAttempt takes that back. Otherwise it returns how long the client
+// has to wait, and nothing is counted.
+func (cfg *apiConfig) startLoginAttempt(r *http.Request, email string) (loginAttempt, time.Duration, error) {
+	attempt := loginAttempt{
+		accountKey: accountLoginKey(email),
+		ipKey:      ipLoginKey(r),
+	}
+	// Sorted, so that concurrent attempts lock the rows in the same order.
+	keys := []string{attempt.accountKey, attempt.ipKey}
+	now := cfg.now().UTC()
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return loginAttempt{}, 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// Creating the rows first means there is always one to lock, even for
+	// the first attempt.
+	if err := qtx.CreateLoginFailures(r.Context(), database.CreateLoginFailuresParams{
+		Keys:      keys,
+		CreatedAt: now,
+	}); err != nil {
+		return loginAttempt{}, 0, err
+	}
+	failures, err := qtx.GetLoginFailuresForUpdate(r.Context(), keys)
+	if err != nil {
+		return loginAttempt{}, 0, err
+	}
+
+	var wait time.Duration
+	for _, failure := range failures {
+		policy := ipLoginPolicy
+		if failure.Key == attempt.accountKey {
+			policy = accountLoginPolicy
+		}
+		wait = max(wait, policy.RetryAfter(int(failure.Failures), failure.LastFailedAt, now))
+	}
+	if wait > 0 {
+		return loginAttempt{}, wait, nil
+	}
+
+	for _, key := range keys {
+		failure, err := qtx.RecordLoginFailure(r.Context(), database.RecordLoginFailureParams{
+			Key:         key,
+			FailedAt:    now,
+			WindowStart: now.Add(-loginFailureWindow),
+		})
+		if err != nil {
+			return loginAttempt{}, 0, err
+		}
+		if key == attempt.accountKey {
+			attempt.accountFailures = failure.Failures
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return loginAttempt{}, 0, err
+	}
+	return attempt, 0, nil
+}
+
+// passLoginAttempt takes back the failure counted for an attempt whose
+// password or code turned out to be right.
+func (cfg *apiConfig) passLoginAttempt(r *http.Request, attempt loginAttempt) error {
+	return cfg.dbQueries.ReleaseLoginFailures(r.Context(), []string{attempt.accountKey, attempt.ipKey})
+}
+
+// failLoginAttempt tells the owner of the account by email when the failed
+// attempt locked it out. dbUser is nil when there is no such account.
+func (cfg *apiConfig) failLoginAttempt(r *http.Request, attempt loginAttempt, dbUser *database.User) {
+	if dbUser == nil || int(attempt.accountFailures) != accountLoginPolicy.LockoutAfter {
+		return
+	}
+
+	if err := recordSecurityEvent(r, cfg.dbQueries, dbUser.ID, securityEventLoginLockout, ""); err != nil {
+		log.Printf("Unable to record security event: %s", err)
+	}
+	cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Sign-ins to your Chirpy account are paused",
+		Body: fmt.Sprintf(
+			"There were %d failed attempts to sign in to your Chirpy account, the last one from %s. Sign-ins are paused for %s.\n\nIf this was not you, someone may be trying to guess your password. Consider choosing a new one and enabling two-factor authentication.\n",
+			attempt.accountFailures, clientIP(r), accountLoginPolicy.LockoutDuration,
+		),
+	})
+}
+
+// clearLoginFailures forgets the failed logins to the account with email
+// after a successful one. Failures from the address are kept, so that
+// signing in to one account does not allow guessing more passwords of
+// others.
+func (cfg *apiConfig) clearLoginFailures(r *http.Request, email string) error {
+	return cfg.dbQueries.DeleteLoginFailures(r.Context(), accountLoginKey(email))
+}
+
+// respondTooManyLoginAttempts refuses a throttled login attempt.
+func respondTooManyLoginAttempts(w http.ResponseWriter, wait time.Duration) {
+	setRetryAfter(w, wait)
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+}
+
+// setRetryAfter tells the client how long to wait before trying again.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
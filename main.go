@@ -1,24 +1,45 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"sync/atomic"
+	"time"
 
+	"example.com/chirpy/internal/auth"
 	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/events"
+	"example.com/chirpy/internal/mailer"
+	"example.com/chirpy/internal/storage"
+	"example.com/chirpy/internal/stream"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
 	fileServerHits atomic.Int32
+	db             *sql.DB
 	dbQueries      *database.Queries
 	platform       string
-	jwtSecret      string
+	jwtKeys        *auth.KeySet
 	polkaKey       string
+	signingSecret  string
+	mailer         mailer.Mailer
+	media          storage.Storage
+	exports        storage.Storage
+	events         events.Bus
+	stream         *stream.Broker
+	websockets     *wsConnections
+
+	// now is the clock used for time-based one-time passwords and login
+	// challenges.
+	now func() time.Time
+
+	unverifiedRestrictions map[string]bool
 }
 
 func main() {
@@ -42,10 +63,22 @@ func main() {
 		return
 	}
 
+	// With JWT_KEY_DIR, access tokens are signed with the asymmetric keys in
+	// it and JWT_SECRET is only used to verify tokens signed before.
 	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		fmt.Println("Unable to load JWT_SECRET")
-		return
+	var jwtKeys *auth.KeySet
+	if keyDir := os.Getenv("JWT_KEY_DIR"); keyDir != "" {
+		jwtKeys, err = auth.LoadKeySet(keyDir, os.Getenv("JWT_SIGNING_KEY_ID"), jwtSecret)
+		if err != nil {
+			fmt.Printf("Unable to load JWT keys: %s\n", err)
+			return
+		}
+	} else {
+		if jwtSecret == "" {
+			fmt.Println("Unable to load JWT_SECRET")
+			return
+		}
+		jwtKeys = auth.NewHMACKeySet(jwtSecret)
 	}
 
 	polkaKey := os.Getenv("POLKA_KEY")
@@ -54,31 +87,208 @@ func main() {
 		return
 	}
 
+	signingSecret := os.Getenv("SIGNING_SECRET")
+	if signingSecret == "" {
+		fmt.Println("Unable to load SIGNING_SECRET")
+		return
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	var mail mailer.Mailer
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		mail, err = mailer.NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			mailFrom,
+		)
+		if err != nil {
+			fmt.Printf("Unable to set up SMTP mailer: %s\n", err)
+			return
+		}
+	case "memory":
+		mail = mailer.NewMemoryMailer()
+	case "", "file":
+		mailDir := os.Getenv("MAIL_DIR")
+		if mailDir == "" {
+			mailDir = "mail"
+		}
+		mail, err = mailer.NewFileMailer(mailDir, mailFrom)
+		if err != nil {
+			fmt.Printf("Unable to create mail directory: %s\n", err)
+			return
+		}
+	default:
+		fmt.Println("Unknown MAILER, expected smtp, file or memory")
+		return
+	}
+
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	media, err := storage.NewLocal(mediaDir, "/media")
+	if err != nil {
+		fmt.Printf("Unable to create media directory: %s\n", err)
+		return
+	}
+
+	exportDir := os.Getenv("EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = "exports"
+	}
+	exports, err := storage.NewLocal(exportDir, "")
+	if err != nil {
+		fmt.Printf("Unable to create export directory: %s\n", err)
+		return
+	}
+
+	var bus events.Bus
+	switch os.Getenv("EVENT_BUS") {
+	case "postgres":
+		bus, err = events.NewPostgres(db, dbURL)
+		if err != nil {
+			fmt.Printf("Unable to listen for events: %s\n", err)
+			return
+		}
+	case "", "local":
+		bus = events.NewLocal()
+	default:
+		fmt.Println("Unknown EVENT_BUS, expected postgres or local")
+		return
+	}
+	defer bus.Close()
+
 	const port string = "8080"
 	const root string = "."
 
 	apiConfig := apiConfig{
 		fileServerHits: atomic.Int32{},
+		db:             db,
 		dbQueries:      dbQueries,
 		platform:       platform,
-		jwtSecret:      jwtSecret,
+		jwtKeys:        jwtKeys,
 		polkaKey:       polkaKey,
+		signingSecret:  signingSecret,
+		mailer:         mail,
+		media:          media,
+		exports:        exports,
+		events:         bus,
+		stream:         stream.NewBroker(streamReplaySize, streamBufferSize),
+		websockets:     newWSConnections(),
+		now:            time.Now,
+
+		unverifiedRestrictions: parseRestrictions(os.Getenv("UNVERIFIED_RESTRICTIONS")),
+	}
+
+	if len(os.Args) > 1 {
+		if err := apiConfig.runCommand(os.Args[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
 	}
 
+	apiConfig.events.Subscribe(apiConfig.relayEvent)
+	go apiConfig.failStaleImports(context.Background())
+
 	mux := http.NewServeMux()
 	mux.Handle("/app/", http.StripPrefix("/app/", apiConfig.middleWareMetricsInc(http.FileServer(http.Dir(root)))))
+	mux.Handle("/media/", http.StripPrefix("/media/", media.Handler()))
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
-	mux.HandleFunc("GET /admin/metrics", apiConfig.handlerMetricsShow)
-	mux.HandleFunc("POST /admin/reset", apiConfig.handlerReset)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiConfig.handlerJWKS)
+
+	// Everything under /admin/ needs an admin and everything under
+	// /api/admin/ at least a moderator.
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("GET /admin/metrics", apiConfig.handlerMetricsShow)
+	adminMux.HandleFunc("POST /admin/reset", apiConfig.handlerReset)
+	mux.Handle("/admin/", apiConfig.authenticated(apiConfig.requireRole(auth.RoleAdmin, adminMux)))
+
+	moderationMux := http.NewServeMux()
+	moderationMux.HandleFunc("GET /api/admin/reports", apiConfig.handlerGetReports)
+	moderationMux.HandleFunc("GET /api/admin/reports/{reportID}", apiConfig.handlerGetReport)
+	moderationMux.HandleFunc("POST /api/admin/reports/{reportID}/actions", apiConfig.handlerModerateReport)
+	moderationMux.HandleFunc("GET /api/admin/users", apiConfig.handlerAdminGetUsers)
+	moderationMux.HandleFunc("GET /api/admin/users/{userID}", apiConfig.handlerAdminGetUser)
+	moderationMux.HandleFunc("POST /api/admin/users/{userID}/suspend", apiConfig.handlerAdminSuspendUser)
+	moderationMux.Handle("POST /api/admin/users/{userID}/ban", apiConfig.requireRole(auth.RoleAdmin, http.HandlerFunc(apiConfig.handlerAdminBanUser)))
+	moderationMux.Handle("POST /api/admin/users/{userID}/unban", apiConfig.requireRole(auth.RoleAdmin, http.HandlerFunc(apiConfig.handlerAdminUnbanUser)))
+	moderationMux.Handle("PUT /api/admin/users/{userID}/role", apiConfig.requireRole(auth.RoleAdmin, http.HandlerFunc(apiConfig.handlerSetUserRole)))
+	mux.Handle("/api/admin/", apiConfig.authenticated(apiConfig.requireRole(auth.RoleModerator, moderationMux)))
+
 	mux.HandleFunc("POST /api/users", apiConfig.handlerCreateUser)
-	mux.HandleFunc("PUT /api/users", apiConfig.handlerUpdateUser)
-	mux.HandleFunc("POST /api/chirps", apiConfig.handlerCreateChirp)
+	mux.Handle("PUT /api/users", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerUpdateUser)))
+	mux.Handle("PATCH /api/users/me", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerPatchUser)))
+	mux.Handle("GET /api/users/me", apiConfig.requireScope(auth.ScopeProfile, http.HandlerFunc(apiConfig.handlerGetCurrentUser)))
+	mux.HandleFunc("GET /api/users/{userID}", apiConfig.handlerGetProfile)
+	mux.Handle("POST /api/users/{userID}/report", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerReportUser)))
+	mux.HandleFunc("GET /api/users/search", apiConfig.handlerSearchUsers)
+	mux.HandleFunc("GET /api/users/autocomplete", apiConfig.handlerAutocompleteHandles)
+	mux.Handle("PUT /api/users/me/avatar", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerUploadAvatar)))
+	mux.Handle("PUT /api/users/me/banner", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerUploadBanner)))
+	mux.Handle("POST /api/users/me/export", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerCreateDataExport)))
+	mux.HandleFunc("GET /api/users/me/export/{exportID}", apiConfig.handlerGetDataExport)
+	mux.Handle("POST /api/users/me/2fa", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerEnrollTOTP)))
+	mux.Handle("POST /api/users/me/2fa/confirm", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerConfirmTOTP)))
+	mux.Handle("POST /api/users/me/2fa/disable", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerDisableTOTP)))
+	mux.HandleFunc("POST /api/users/verify", apiConfig.handlerVerifyEmail)
+	mux.Handle("POST /api/users/verify/resend", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerResendVerificationEmail)))
+	mux.Handle("POST /api/chirps", apiConfig.requireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiConfig.handlerCreateChirp)))
 	mux.HandleFunc("GET /api/chirps", apiConfig.handlerGetAllChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiConfig.handlerGetChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiConfig.handlerDeleteChirp)
+	mux.HandleFunc("GET /api/stream", apiConfig.handlerStream)
+	mux.Handle("GET /api/ws", wsBearerFromProtocol(apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerWebSocket))))
+	mux.Handle("DELETE /api/chirps/{chirpID}", apiConfig.requireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiConfig.handlerDeleteChirp)))
+	mux.Handle("POST /api/chirps/{chirpID}/report", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerReportChirp)))
+	mux.Handle("POST /api/conversations", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerCreateConversation)))
+	mux.Handle("GET /api/conversations", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerGetConversations)))
+	mux.Handle("GET /api/conversations/{conversationID}/messages", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerGetMessages)))
+	mux.Handle("POST /api/conversations/{conversationID}/messages", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerCreateMessage)))
+	mux.Handle("POST /api/conversations/{conversationID}/read", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerMarkConversationRead)))
+	mux.Handle("POST /api/lists", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerCreateList)))
+	mux.Handle("GET /api/lists", apiConfig.requireScope(auth.ScopeChirpsRead, http.HandlerFunc(apiConfig.handlerGetLists)))
+	mux.Handle("GET /api/lists/subscribed", apiConfig.requireScope(auth.ScopeChirpsRead, http.HandlerFunc(apiConfig.handlerGetSubscribedLists)))
+	mux.Handle("GET /api/lists/{listID}", apiConfig.requireScope(auth.ScopeChirpsRead, http.HandlerFunc(apiConfig.handlerGetList)))
+	mux.Handle("PATCH /api/lists/{listID}", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerUpdateList)))
+	mux.Handle("DELETE /api/lists/{listID}", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerDeleteList)))
+	mux.Handle("GET /api/lists/{listID}/members", apiConfig.requireScope(auth.ScopeChirpsRead, http.HandlerFunc(apiConfig.handlerGetListMembers)))
+	mux.Handle("PUT /api/lists/{listID}/members/{userID}", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerAddListMember)))
+	mux.Handle("DELETE /api/lists/{listID}/members/{userID}", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerRemoveListMember)))
+	mux.Handle("PUT /api/lists/{listID}/subscription", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerSubscribeToList)))
+	mux.Handle("DELETE /api/lists/{listID}/subscription", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerUnsubscribeFromList)))
+	mux.Handle("GET /api/lists/{listID}/timeline", apiConfig.requireScope(auth.ScopeChirpsRead, http.HandlerFunc(apiConfig.handlerGetListTimeline)))
+	mux.Handle("GET /api/notifications", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerGetNotifications)))
+	mux.Handle("POST /api/notifications/read", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerMarkNotificationsRead)))
+	mux.Handle("GET /api/notifications/preferences", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerGetNotificationPreferences)))
+	mux.Handle("PUT /api/notifications/preferences", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerUpdateNotificationPreferences)))
+	mux.Handle("POST /api/imports", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerCreateImport)))
+	mux.Handle("GET /api/imports/{importID}", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerGetImport)))
 	mux.HandleFunc("POST /api/login", apiConfig.handlerLogin)
+	mux.HandleFunc("POST /api/login/2fa", apiConfig.handlerLoginTwoFactor)
+	mux.HandleFunc("POST /api/password/forgot", apiConfig.handlerForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiConfig.handlerResetPassword)
 	mux.HandleFunc("POST /api/revoke", apiConfig.handlerRevokeRefreshToken)
+	mux.Handle("GET /api/sessions", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerGetSessions)))
+	mux.Handle("DELETE /api/sessions/{sessionID}", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerRevokeSession)))
+	mux.Handle("POST /api/sessions/revoke-others", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerRevokeOtherSessions)))
 	mux.HandleFunc("POST /api/refresh", apiConfig.handlerUpdateRefreshToken)
+	mux.Handle("POST /api/tokens", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerCreatePersonalAccessToken)))
+	mux.Handle("GET /api/tokens", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerGetPersonalAccessTokens)))
+	mux.Handle("DELETE /api/tokens/{tokenID}", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerRevokePersonalAccessToken)))
+	mux.Handle("POST /api/oauth/clients", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerCreateOAuthClient)))
+	mux.Handle("GET /api/oauth/clients", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerGetOAuthClients)))
+	mux.Handle("DELETE /api/oauth/clients/{clientID}", apiConfig.authenticated(http.HandlerFunc(apiConfig.handlerDeleteOAuthClient)))
+	mux.HandleFunc("GET /oauth/authorize", apiConfig.handlerAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", apiConfig.handlerApproveAuthorization)
+	mux.HandleFunc("POST /oauth/token", apiConfig.handlerOAuthToken)
+	mux.HandleFunc("POST /oauth/revoke", apiConfig.handlerOAuthRevoke)
 	mux.HandleFunc("POST /api/polka/webhooks", apiConfig.handlerEnableChirpyRed)
 
 	server := http.Server{
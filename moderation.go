@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/events"
+	"github.com/google/uuid"
+)
+
+// Decisions a moderator can make on a report or, directly, on a user.
+const (
+	moderationDismiss     string = "dismiss"
+	moderationDeleteChirp string = "delete_chirp"
+	moderationSuspendUser string = "suspend_user"
+	moderationBanUser     string = "ban_user"
+	moderationUnbanUser   string = "unban_user"
+)
+
+const maxSuspensionHours int = 365 * 24
+const defaultReportPageSize int = 50
+const maxReportPageSize int = 100
+
+type moderationAction struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ModeratorID    *uuid.UUID `json:"moderator_id"`
+	TargetUserID   *uuid.UUID `json:"target_user_id"`
+	ChirpID        *uuid.UUID `json:"chirp_id"`
+	Action         string     `json:"action"`
+	Reason         string     `json:"reason"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+}
+
+func moderationActionFromDatabase(dbAction database.ModerationAction) moderationAction {
+	result := moderationAction{
+		ID:        dbAction.ID,
+		CreatedAt: dbAction.CreatedAt,
+		Action:    dbAction.Action,
+		Reason:    dbAction.Reason,
+	}
+	if dbAction.ModeratorID.Valid {
+		result.ModeratorID = &dbAction.ModeratorID.UUID
+	}
+	if dbAction.TargetUserID.Valid {
+		result.TargetUserID = &dbAction.TargetUserID.UUID
+	}
+	if dbAction.ChirpID.Valid {
+		result.ChirpID = &dbAction.ChirpID.UUID
+	}
+	if dbAction.SuspendedUntil.Valid {
+		result.SuspendedUntil = &dbAction.SuspendedUntil.Time
+	}
+	return result
+}
+
+// suspendUser suspends a user until the given time and revokes their
+// refresh tokens and personal access tokens so that they are signed out
+// once their access token expires.
+func suspendUser(ctx context.Context, q *database.Queries, userId uuid.UUID, until time.Time) error {
+	if err := q.SuspendUser(ctx, database.SuspendUserParams{
+		SuspendedUntil: sql.NullTime{Time: until, Valid: true},
+		ID:             userId,
+	}); err != nil {
+		return err
+	}
+	return revokeAllTokens(ctx, q, userId)
+}
+
+// handlerGetReports returns reports with the given status, open by default,
+// oldest first.
+func (cfg *apiConfig) handlerGetReports(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	}
+	if status != "open" && status != "resolved" {
+		respondWithError(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	limit := defaultReportPageSize
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(parsed, maxReportPageSize)
+	}
+
+	dbReports, err := cfg.dbQueries.GetReportsByStatus(r.Context(), database.GetReportsByStatusParams{
+		Status: status,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		log.Printf("Unable to fetch reports: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	reports := []report{}
+	for _, dbReport := range dbReports {
+		reports = append(reports, reportFromDatabase(dbReport))
+	}
+
+	respondWithJson(w, http.StatusOK, reports)
+}
+
+func (cfg *apiConfig) handlerGetReport(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		report
+		Actions []moderationAction `json:"actions"`
+	}
+
+	reportId, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	dbReport, err := cfg.dbQueries.GetReport(r.Context(), reportId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	dbActions, err := cfg.dbQueries.GetModerationActionsForReport(r.Context(), uuid.NullUUID{UUID: reportId, Valid: true})
+	if err != nil {
+		log.Printf("Unable to fetch moderation actions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	resp := response{
+		report:  reportFromDatabase(dbReport),
+		Actions: []moderationAction{},
+	}
+	for _, dbAction := range dbActions {
+		resp.Actions = append(resp.Actions, moderationActionFromDatabase(dbAction))
+	}
+
+	respondWithJson(w, http.StatusOK, resp)
+}
+
+// handlerModerateReport resolves an open report by dismissing it, deleting
+// the reported chirp or suspending the reported user, and records the
+// decision. Deleting a chirp resolves every open report about it.
+func (cfg *apiConfig) handlerModerateReport(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Action        string `json:"action"`
+		Reason        string `json:"reason"`
+		DurationHours int    `json:"duration_hours"`
+	}
+
+	caller := principalFromContext(r.Context())
+
+	reportId, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	dbReport, err := qtx.GetReport(r.Context(), reportId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if dbReport.Status != "open" {
+		respondWithError(w, http.StatusConflict, "Report is already resolved")
+		return
+	}
+
+	action := database.CreateModerationActionParams{
+		ReportID:     uuid.NullUUID{UUID: dbReport.ID, Valid: true},
+		ModeratorID:  uuid.NullUUID{UUID: caller.UserID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: dbReport.ReportedUserID, Valid: true},
+		ChirpID:      dbReport.ChirpID,
+		Action:       params.Action,
+		Reason:       params.Reason,
+	}
+
+	var deletedChirp *database.Chirp
+	switch params.Action {
+	case moderationDismiss:
+
+	case moderationDeleteChirp:
+		if !dbReport.ChirpID.Valid {
+			respondWithError(w, http.StatusBadRequest, "Report is not about a chirp")
+			return
+		}
+		dbChirp, err := qtx.GetChirp(r.Context(), dbReport.ChirpID.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusConflict, "Chirp is already deleted")
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to fetch chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := qtx.ResolveOpenReportsForChirp(r.Context(), dbReport.ChirpID); err != nil {
+			log.Printf("Unable to resolve reports: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := qtx.DeleteChirp(r.Context(), dbChirp.ID); err != nil {
+			log.Printf("Unable to delete chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		deletedChirp = &dbChirp
+
+	case moderationSuspendUser:
+		if params.DurationHours < 1 || params.DurationHours > maxSuspensionHours {
+			respondWithError(w, http.StatusBadRequest, "Invalid suspension duration")
+			return
+		}
+		if strings.TrimSpace(params.Reason) == "" {
+			respondWithError(w, http.StatusBadRequest, "A reason is required")
+			return
+		}
+		// Like moderateUser, only users whose role is below the caller's can
+		// be suspended.
+		dbUser, err := qtx.GetUserByID(r.Context(), dbReport.ReportedUserID)
+		if err != nil {
+			log.Printf("Unable to fetch user: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if auth.HasRole(dbUser.Role, caller.Role) {
+			respondWithError(w, http.StatusForbidden, "You cannot moderate this user")
+			return
+		}
+		suspendedUntil := sql.NullTime{
+			Time:  time.Now().UTC().Add(time.Duration(params.DurationHours) * time.Hour),
+			Valid: true,
+		}
+		if err := suspendUser(r.Context(), qtx, dbReport.ReportedUserID, suspendedUntil.Time); err != nil {
+			log.Printf("Unable to suspend user: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		action.SuspendedUntil = suspendedUntil
+
+	default:
+		respondWithError(w, http.StatusBadRequest, "Unknown moderation action")
+		return
+	}
+
+	dbAction, err := qtx.CreateModerationAction(r.Context(), action)
+	if err != nil {
+		log.Printf("Unable to record moderation action: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := qtx.ResolveReport(r.Context(), dbReport.ID); err != nil {
+		log.Printf("Unable to resolve report: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit moderation action: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if deletedChirp != nil {
+		cfg.publishEvent(r.Context(), events.ChirpDeleted, chirpFromDatabase(*deletedChirp), nil)
+	}
+
+	respondWithJson(w, http.StatusCreated, moderationActionFromDatabase(dbAction))
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/events"
+	"github.com/google/uuid"
+)
+
+// Notification types. The subject of a notification is what it is about:
+// the chirp for mentions, replies, reactions and rechirps, the conversation
+// for messages and the followed user for follows.
+const (
+	notificationFollow   string = "follow"
+	notificationReply    string = "reply"
+	notificationMention  string = "mention"
+	notificationReaction string = "reaction"
+	notificationRechirp  string = "rechirp"
+	notificationMessage  string = "message"
+)
+
+var notificationTypes = []string{
+	notificationFollow,
+	notificationReply,
+	notificationMention,
+	notificationReaction,
+	notificationRechirp,
+	notificationMessage,
+}
+
+const defaultNotificationPageSize int = 50
+const maxNotificationPageSize int = 100
+const maxMentionsPerChirp int = 10
+
+type notification struct {
+	ID        uuid.UUID   `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Type      string      `json:"type"`
+	SubjectID uuid.UUID   `json:"subject_id"`
+	ActorIDs  []uuid.UUID `json:"actor_ids"`
+	Count     int         `json:"count"`
+	ReadAt    *time.Time  `json:"read_at"`
+}
+
+func notificationFromDatabase(dbNotification database.Notification) notification {
+	result := notification{
+		ID:        dbNotification.ID,
+		CreatedAt: dbNotification.CreatedAt,
+		UpdatedAt: dbNotification.UpdatedAt,
+		Type:      dbNotification.Type,
+		SubjectID: dbNotification.SubjectID,
+		ActorIDs:  dbNotification.ActorIds,
+		Count:     len(dbNotification.ActorIds),
+	}
+	if dbNotification.ReadAt.Valid {
+		result.ReadAt = &dbNotification.ReadAt.Time
+	}
+	return result
+}
+
+// notify records that actor did something of kind notificationType to
+// subject, which the recipient should hear about. It is grouped with an
+// unread notification of the same type about the same subject if there is
+// one. Users are never notified about their own actions, nor about types they
+// turned off. Failures are logged rather than returned so that they never
+// fail the action that caused them. The notification is also pushed to the
+// recipient's open WebSocket connections.
+func (cfg *apiConfig) notify(ctx context.Context, recipientId uuid.UUID, notificationType string, subjectId, actorId uuid.UUID) {
+	if recipientId == actorId {
+		return
+	}
+
+	disabled, err := cfg.dbQueries.IsNotificationDisabled(ctx, database.IsNotificationDisabledParams{
+		UserID: recipientId,
+		Type:   notificationType,
+	})
+	if err != nil {
+		log.Printf("Unable to fetch notification preference: %s", err)
+		return
+	}
+	if disabled {
+		return
+	}
+
+	dbNotification, err := cfg.dbQueries.CreateOrGroupNotification(ctx, database.CreateOrGroupNotificationParams{
+		UserID:    recipientId,
+		Type:      notificationType,
+		SubjectID: subjectId,
+		ActorID:   actorId,
+	})
+	if err != nil {
+		log.Printf("Unable to create %s notification: %s", notificationType, err)
+		return
+	}
+
+	cfg.publishEvent(ctx, events.NotificationCreated, notificationFromDatabase(dbNotification), []uuid.UUID{recipientId})
+}
+
+// notifyMentions notifies every user mentioned by handle in dbChirp.
+func (cfg *apiConfig) notifyMentions(ctx context.Context, dbChirp database.Chirp) {
+	handles := parseMentions(dbChirp.Body)
+	if len(handles) == 0 {
+		return
+	}
+
+	dbUsers, err := cfg.dbQueries.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		log.Printf("Unable to fetch mentioned users: %s", err)
+		return
+	}
+	for _, dbUser := range dbUsers {
+		cfg.notify(ctx, dbUser.ID, notificationMention, dbChirp.ID, dbChirp.UserID)
+	}
+}
+
+// parseMentions returns the distinct handles mentioned as @handle in text.
+func parseMentions(text string) []string {
+	handles := []string{}
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if !strings.HasPrefix(word, "@") {
+			continue
+		}
+		end := 1
+		for end < len(word) && isHandleChar(rune(word[end])) {
+			end++
+		}
+		handle, err := normalizeHandle(word[:end])
+		if err != nil || slices.Contains(handles, handle) {
+			continue
+		}
+		handles = append(handles, handle)
+		if len(handles) == maxMentionsPerChirp {
+			break
+		}
+	}
+	return handles
+}
+
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	limit := defaultNotificationPageSize
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(parsed, maxNotificationPageSize)
+	}
+
+	dbNotifications, err := cfg.dbQueries.GetNotifications(r.Context(), database.GetNotificationsParams{
+		UserID:     userId,
+		UnreadOnly: r.URL.Query().Get("unread") == "true",
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		log.Printf("Unable to fetch notifications: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	notifications := []notification{}
+	for _, dbNotification := range dbNotifications {
+		notifications = append(notifications, notificationFromDatabase(dbNotification))
+	}
+
+	respondWithJson(w, http.StatusOK, notifications)
+}
+
+// handlerMarkNotificationsRead marks the given notifications as read, or all
+// of them when no IDs are given.
+func (cfg *apiConfig) handlerMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		IDs []uuid.UUID `json:"ids"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	var params parameters
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&params); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+	}
+
+	var err error
+	if len(params.IDs) == 0 {
+		err = cfg.dbQueries.MarkAllNotificationsRead(r.Context(), userId)
+	} else {
+		err = cfg.dbQueries.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+			UserID: userId,
+			Ids:    params.IDs,
+		})
+	}
+	if err != nil {
+		log.Printf("Unable to mark notifications read: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notificationPreferences maps every notification type to whether it is
+// enabled. Types without a stored preference are enabled.
+func (cfg *apiConfig) notificationPreferences(ctx context.Context, userId uuid.UUID) (map[string]bool, error) {
+	dbPreferences, err := cfg.dbQueries.GetNotificationPreferences(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences := map[string]bool{}
+	for _, notificationType := range notificationTypes {
+		preferences[notificationType] = true
+	}
+	for _, dbPreference := range dbPreferences {
+		preferences[dbPreference.Type] = dbPreference.Enabled
+	}
+	return preferences, nil
+}
+
+func (cfg *apiConfig) handlerGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	preferences, err := cfg.notificationPreferences(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch notification preferences: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, preferences)
+}
+
+// handlerUpdateNotificationPreferences takes a map of notification types to
+// whether they should be enabled. Types that are left out are unchanged.
+func (cfg *apiConfig) handlerUpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	var params map[string]bool
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	for notificationType := range params {
+		if !slices.Contains(notificationTypes, notificationType) {
+			respondWithError(w, http.StatusBadRequest, "Unknown notification type "+notificationType)
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	for notificationType, enabled := range params {
+		if err := qtx.SetNotificationPreference(r.Context(), database.SetNotificationPreferenceParams{
+			UserID:  userId,
+			Type:    notificationType,
+			Enabled: enabled,
+		}); err != nil {
+			log.Printf("Unable to update notification preference: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit notification preferences: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	preferences, err := cfg.notificationPreferences(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch notification preferences: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, preferences)
+}
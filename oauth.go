@@ -0,0 +1,629 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/totp"
+	"github.com/google/uuid"
+)
+
+const authorizationCodeExpiresIn time.Duration = 10 * time.Minute
+
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:  "Read chirps, including those of your private lists",
+	auth.ScopeChirpsWrite: "Post and delete chirps in your name",
+	auth.ScopeProfile:     "See your profile, including your email address",
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+  <head><meta charset="utf-8"><title>Authorize {{.ClientName}}</title></head>
+  <body>
+    <h1>Authorize {{.ClientName}}</h1>
+    <p>{{.ClientName}} would like to:</p>
+    <ul>
+    {{- range .ScopeDescriptions}}
+      <li>{{.}}</li>
+    {{- end}}
+    </ul>
+    {{- if .Error}}
+    <p role="alert">{{.Error}}</p>
+    {{- end}}
+    <form method="post" action="/oauth/authorize">
+      <input type="hidden" name="response_type" value="code">
+      <input type="hidden" name="client_id" value="{{.ClientID}}">
+      {{- if .RedirectURIProvided}}
+      <input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+      {{- end}}
+      <input type="hidden" name="scope" value="{{.Scope}}">
+      <input type="hidden" name="state" value="{{.State}}">
+      <input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+      <input type="hidden" name="code_challenge_method" value="S256">
+      <p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+      <p><label>Password <input type="password" name="password" required></label></p>
+      <p><label>Authentication or recovery code, if two-factor authentication is enabled <input type="text" name="code" autocomplete="one-time-code"></label></p>
+      <p>
+        <button type="submit" name="decision" value="approve">Allow</button>
+        <button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+      </p>
+    </form>
+  </body>
+</html>
+`))
+
+var authorizationErrorTemplate = template.Must(template.New("authorization_error").Parse(`<!DOCTYPE html>
+<html>
+  <head><meta charset="utf-8"><title>Authorization failed</title></head>
+  <body>
+    <h1>Authorization failed</h1>
+    <p>{{.}}</p>
+  </body>
+</html>
+`))
+
+// authorizationRequest is a validated request of a client for a user's
+// authorization, as sent to GET /oauth/authorize and carried through the
+// consent form.
+type authorizationRequest struct {
+	Client      database.OauthClient
+	RedirectURI string
+	// RedirectURIProvided is false when the client left out the redirect
+	// URI and its only registered one is used.
+	RedirectURIProvided bool
+	Scopes              []string
+	State               string
+	CodeChallenge       string
+}
+
+func respondWithOAuthError(w http.ResponseWriter, status int, code, description string) {
+	type errorResponse struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, status, errorResponse{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
+func renderHTML(w http.ResponseWriter, status int, tmpl *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The consent page must not be framed by a page that tricks the user
+	// into clicking Allow.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Unable to render %s page: %s", tmpl.Name(), err)
+	}
+}
+
+// redirectToClient sends the user back to the client with params added to
+// its redirect URI.
+func redirectToClient(w http.ResponseWriter, r *http.Request, redirectURI, state string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		renderHTML(w, http.StatusBadRequest, authorizationErrorTemplate, "Invalid redirect URI")
+		return
+	}
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusSeeOther)
+}
+
+// parseAuthorizationRequest validates the authorization request in values,
+// writing an error otherwise. As long as the client and redirect URI are
+// unknown the error is shown to the user, after that it is sent back to
+// the client.
+func (cfg *apiConfig) parseAuthorizationRequest(w http.ResponseWriter, r *http.Request, values url.Values) (authorizationRequest, bool) {
+	clientId, err := uuid.Parse(values.Get("client_id"))
+	if err != nil {
+		renderHTML(w, http.StatusBadRequest, authorizationErrorTemplate, "Unknown client")
+		return authorizationRequest{}, false
+	}
+	dbClient, err := cfg.dbQueries.GetOAuthClient(r.Context(), clientId)
+	if errors.Is(err, sql.ErrNoRows) {
+		renderHTML(w, http.StatusBadRequest, authorizationErrorTemplate, "Unknown client")
+		return authorizationRequest{}, false
+	}
+	if err != nil {
+		log.Printf("Unable to fetch OAuth client: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return authorizationRequest{}, false
+	}
+
+	redirectURI := values.Get("redirect_uri")
+	redirectURIProvided := redirectURI != ""
+	if !redirectURIProvided && len(dbClient.RedirectUris) == 1 {
+		redirectURI = dbClient.RedirectUris[0]
+	}
+	if !slices.Contains(dbClient.RedirectUris, redirectURI) {
+		renderHTML(w, http.StatusBadRequest, authorizationErrorTemplate, "Redirect URI is not registered for "+dbClient.Name)
+		return authorizationRequest{}, false
+	}
+
+	state := values.Get("state")
+	fail := func(code, description string) (authorizationRequest, bool) {
+		redirectToClient(w, r, redirectURI, state, url.Values{
+			"error":             {code},
+			"error_description": {description},
+		})
+		return authorizationRequest{}, false
+	}
+
+	if values.Get("response_type") != "code" {
+		return fail("unsupported_response_type", "Only the code response type is supported")
+	}
+	if values.Get("code_challenge_method") != "S256" {
+		return fail("invalid_request", "A PKCE code challenge with the S256 method is required")
+	}
+	codeChallenge := values.Get("code_challenge")
+	if len(codeChallenge) != 43 {
+		return fail("invalid_request", "Invalid PKCE code challenge")
+	}
+	scopes, err := auth.ParseScopes(values.Get("scope"))
+	if err != nil {
+		return fail("invalid_scope", err.Error())
+	}
+	if len(scopes) == 0 {
+		return fail("invalid_scope", "No scope requested")
+	}
+
+	return authorizationRequest{
+		Client:              dbClient,
+		RedirectURI:         redirectURI,
+		RedirectURIProvided: redirectURIProvided,
+		Scopes:              scopes,
+		State:               state,
+		CodeChallenge:       codeChallenge,
+	}, true
+}
+
+func renderConsent(w http.ResponseWriter, status int, request authorizationRequest, email, message string) {
+	descriptions := []string{}
+	for _, scope := range request.Scopes {
+		descriptions = append(descriptions, scopeDescriptions[scope])
+	}
+	renderHTML(w, status, consentTemplate, struct {
+		ClientName          string
+		ClientID            uuid.UUID
+		RedirectURI         string
+		RedirectURIProvided bool
+		Scope               string
+		State               string
+		CodeChallenge       string
+		ScopeDescriptions   []string
+		Email               string
+		Error               string
+	}{
+		ClientName:          request.Client.Name,
+		ClientID:            request.Client.ID,
+		RedirectURI:         request.RedirectURI,
+		RedirectURIProvided: request.RedirectURIProvided,
+		Scope:               strings.Join(request.Scopes, " "),
+		State:               request.State,
+		CodeChallenge:       request.CodeChallenge,
+		ScopeDescriptions:   descriptions,
+		Email:               email,
+		Error:               message,
+	})
+}
+
+// handlerAuthorize shows the consent page for an authorization request.
+func (cfg *apiConfig) handlerAuthorize(w http.ResponseWriter, r *http.Request) {
+	request, ok := cfg.parseAuthorizationRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+	renderConsent(w, http.StatusOK, request, "", "")
+}
+
+// handlerApproveAuthorization handles the consent form. The user signs in
+// on the form itself, so the client never sees their password, and on
+// approval is sent back to the client with an authorization code.
+func (cfg *apiConfig) handlerApproveAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderHTML(w, http.StatusBadRequest, authorizationErrorTemplate, "Invalid form")
+		return
+	}
+
+	request, ok := cfg.parseAuthorizationRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	if r.PostForm.Get("decision") != "approve" {
+		redirectToClient(w, r, request.RedirectURI, request.State, url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"The user denied the request"},
+		})
+		return
+	}
+
+	// Signing in here is throttled like POST /api/login, which it would
+	// otherwise be a way around.
+	email := r.PostForm.Get("email")
+	attempt, wait, err := cfg.startLoginAttempt(r, email)
+	if err != nil {
+		log.Printf("Unable to start login attempt: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if wait > 0 {
+		setRetryAfter(w, wait)
+		renderConsent(w, http.StatusTooManyRequests, request, email, "Too many failed login attempts, try again later")
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByEmail(r.Context(), email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Unable to fetch user: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	found := err == nil
+
+	var passwordErr error
+	if found {
+		passwordErr = auth.CheckPasswordHash(r.PostForm.Get("password"), dbUser.HashedPassword)
+	} else {
+		passwordErr = auth.CheckNoPasswordHash(r.PostForm.Get("password"))
+	}
+	if passwordErr != nil {
+		var failedUser *database.User
+		if found {
+			failedUser = &dbUser
+		}
+		cfg.failLoginAttempt(r, attempt, failedUser)
+		renderConsent(w, http.StatusUnauthorized, request, email, "Incorrect email or password")
+		return
+	}
+
+	if restriction := accountRestriction(dbUser); restriction != "" {
+		renderConsent(w, http.StatusForbidden, request, email, restriction)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	credential, err := qtx.GetTOTPCredential(r.Context(), dbUser.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Unable to fetch TOTP credential: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err == nil && credential.ConfirmedAt.Valid {
+		code, recoveryCode := r.PostForm.Get("code"), ""
+		if len(code) != totp.Digits {
+			code, recoveryCode = "", code
+		}
+		ok, err := cfg.checkSecondFactor(r, qtx, dbUser.ID, code, recoveryCode)
+		if err != nil {
+			log.Printf("Unable to check second factor: %s", err)
+			renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if !ok {
+			cfg.failLoginAttempt(r, attempt, &dbUser)
+			renderConsent(w, http.StatusUnauthorized, request, email, "Incorrect authentication code")
+			return
+		}
+	}
+
+	if err := cfg.passLoginAttempt(r, attempt); err != nil {
+		log.Printf("Unable to pass login attempt: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err := cfg.clearLoginFailures(r, email); err != nil {
+		log.Printf("Unable to clear login failures: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	code, err := auth.MakeRandomToken()
+	if err != nil {
+		log.Printf("Unable to create authorization code: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := qtx.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:            auth.HashToken(code),
+		ClientID:            request.Client.ID,
+		UserID:              dbUser.ID,
+		RedirectUri:         request.RedirectURI,
+		RedirectUriProvided: request.RedirectURIProvided,
+		Scopes:              request.Scopes,
+		CodeChallenge:       request.CodeChallenge,
+		ExpiresAt:           cfg.now().UTC().Add(authorizationCodeExpiresIn),
+	}); err != nil {
+		log.Printf("Unable to store authorization code: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit authorization code: %s", err)
+		renderHTML(w, http.StatusInternalServerError, authorizationErrorTemplate, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	redirectToClient(w, r, request.RedirectURI, request.State, url.Values{"code": {code}})
+}
+
+// handlerOAuthToken issues tokens to third-party apps, either for an
+// authorization code or for a refresh token. Refresh tokens are rotated
+// and their reuse revokes the family, as for Chirpy's own clients.
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form")
+		return
+	}
+
+	dbClient, ok := cfg.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.exchangeAuthorizationCode(w, r, dbClient)
+	case "refresh_token":
+		cfg.exchangeOAuthRefreshToken(w, r, dbClient)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only the authorization_code and refresh_token grant types are supported")
+	}
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, dbClient database.OauthClient) {
+	code := r.PostForm.Get("code")
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	dbCode, err := qtx.GetOAuthAuthorizationCodeForUpdate(r.Context(), auth.HashToken(code))
+	if err != nil || !auth.CheckTokenHash(code, dbCode.CodeHash) || dbCode.ClientID != dbClient.ID {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		return
+	}
+
+	// A code presented twice was intercepted, so the tokens issued for it
+	// are revoked.
+	if dbCode.UsedAt.Valid {
+		if dbCode.FamilyID.Valid {
+			if err := qtx.RevokeRefreshTokenFamily(r.Context(), dbCode.FamilyID.UUID); err != nil {
+				log.Printf("Unable to revoke refresh token family: %s", err)
+				respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+				return
+			}
+			if err := tx.Commit(); err != nil {
+				log.Printf("Unable to commit refresh token revocation: %s", err)
+				respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+				return
+			}
+		}
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		return
+	}
+
+	// The redirect URI has to be repeated if it was sent to authorize, and
+	// has to match if it is sent at all.
+	redirectURIRequired := dbCode.RedirectUriProvided || r.PostForm.Has("redirect_uri")
+	if !dbCode.ExpiresAt.After(cfg.now()) || redirectURIRequired && dbCode.RedirectUri != r.PostForm.Get("redirect_uri") {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		return
+	}
+	if !auth.CheckPKCE(r.PostForm.Get("code_verifier"), dbCode.CodeChallenge) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid PKCE code verifier")
+		return
+	}
+
+	dbUser, err := qtx.GetUserByID(r.Context(), dbCode.UserID)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if restriction := accountRestriction(dbUser); restriction != "" {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", restriction)
+		return
+	}
+
+	familyId := uuid.New()
+	if err := qtx.UseOAuthAuthorizationCode(r.Context(), database.UseOAuthAuthorizationCodeParams{
+		CodeHash: dbCode.CodeHash,
+		FamilyID: uuid.NullUUID{UUID: familyId, Valid: true},
+	}); err != nil {
+		log.Printf("Unable to use authorization code: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	cfg.issueOAuthTokens(w, r, tx, qtx, dbClient, dbUser.ID, familyId, dbCode.Scopes)
+}
+
+func (cfg *apiConfig) exchangeOAuthRefreshToken(w http.ResponseWriter, r *http.Request, dbClient database.OauthClient) {
+	refreshToken := r.PostForm.Get("refresh_token")
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	dbToken, err := qtx.GetRefreshTokenForUpdate(r.Context(), auth.HashToken(refreshToken))
+	if err != nil || !auth.CheckTokenHash(refreshToken, dbToken.TokenHash) || dbToken.ClientID.UUID != dbClient.ID {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+	if dbToken.RevokedAt.Valid || dbToken.ExpiresAt.Before(time.Now()) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+
+	if dbToken.RotatedAt.Valid {
+		if err := qtx.RevokeRefreshTokenFamily(r.Context(), dbToken.FamilyID); err != nil {
+			log.Printf("Unable to revoke refresh token family: %s", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := recordSecurityEvent(r, qtx, dbToken.UserID, securityEventRefreshTokenReuse,
+			fmt.Sprintf("Token family %s of client %s revoked", dbToken.FamilyID, dbClient.ID)); err != nil {
+			log.Printf("Unable to record security event: %s", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("Unable to commit refresh token revocation: %s", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+
+	dbUser, err := qtx.GetUserByID(r.Context(), dbToken.UserID)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if restriction := accountRestriction(dbUser); restriction != "" {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", restriction)
+		return
+	}
+
+	if err := qtx.RotateRefreshToken(r.Context(), dbToken.TokenHash); err != nil {
+		log.Printf("Unable to retire refresh token: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	cfg.issueOAuthTokens(w, r, tx, qtx, dbClient, dbUser.ID, dbToken.FamilyID, dbToken.Scopes)
+}
+
+// issueOAuthTokens creates a refresh token in the family and an access
+// token limited to scopes, commits tx and responds with both.
+func (cfg *apiConfig) issueOAuthTokens(w http.ResponseWriter, r *http.Request, tx *sql.Tx, qtx *database.Queries, dbClient database.OauthClient, userId, familyId uuid.UUID, scopes []string) {
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+
+	refreshToken, err := storeRefreshToken(r, qtx, database.CreateRefreshTokenParams{
+		UserID:     userId,
+		FamilyID:   familyId,
+		DeviceName: dbClient.Name,
+		ClientID:   uuid.NullUUID{UUID: dbClient.ID, Valid: true},
+		Scopes:     scopes,
+	})
+	if err != nil {
+		log.Printf("Unable to create refresh token: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	accessToken, err := auth.MakeJWT(auth.Claims{
+		UserID:    userId,
+		SessionID: familyId,
+		ClientID:  dbClient.ID,
+		Scopes:    scopes,
+	}, cfg.jwtKeys, accessTokenExpiresIn)
+	if err != nil {
+		log.Printf("Unable to create access token: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit OAuth tokens: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, response{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenExpiresIn.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+// handlerOAuthRevoke revokes the authorization a refresh or access token of
+// the client belongs to (RFC 7009). Access tokens themselves stay valid
+// until they expire. Unknown tokens are not an error, so the response does
+// not reveal which tokens exist.
+func (cfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form")
+		return
+	}
+
+	dbClient, ok := cfg.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	familyId := uuid.Nil
+	if dbToken, err := cfg.dbQueries.GetRefreshTokenForUpdate(r.Context(), auth.HashToken(token)); err == nil {
+		if dbToken.ClientID.UUID == dbClient.ID {
+			familyId = dbToken.FamilyID
+		}
+	} else if claims, err := auth.ParseJWT(token, cfg.jwtKeys); err == nil {
+		if claims.ClientID == dbClient.ID {
+			familyId = claims.SessionID
+		}
+	}
+
+	if familyId != uuid.Nil {
+		if err := cfg.dbQueries.RevokeRefreshTokenFamily(r.Context(), familyId); err != nil {
+			log.Printf("Unable to revoke refresh token family: %s", err)
+			respondWithOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", http.StatusText(http.StatusServiceUnavailable))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
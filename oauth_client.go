@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxOAuthClientNameLength int = 100
+const maxRedirectURIs int = 10
+
+// oauthClient is a third-party app registered by a user. Confidential
+// clients authenticate with a secret; public clients, such as mobile apps,
+// cannot keep one and rely on PKCE alone.
+type oauthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+}
+
+func oauthClientFromDatabase(dbClient database.OauthClient) oauthClient {
+	return oauthClient{
+		ID:           dbClient.ID,
+		CreatedAt:    dbClient.CreatedAt,
+		Name:         dbClient.Name,
+		RedirectURIs: dbClient.RedirectUris,
+		Confidential: dbClient.SecretHash.Valid,
+	}
+}
+
+// validateRedirectURI accepts absolute https URIs, and http URIs on the
+// loopback interface for apps running on the user's machine.
+func validateRedirectURI(rawURI string) error {
+	uri, err := url.Parse(rawURI)
+	if err != nil || !uri.IsAbs() || uri.Host == "" {
+		return fmt.Errorf("Redirect URI %q is not an absolute URI", rawURI)
+	}
+	if uri.Fragment != "" {
+		return fmt.Errorf("Redirect URI %q must not have a fragment", rawURI)
+	}
+	if uri.Scheme == "https" {
+		return nil
+	}
+	if uri.Scheme == "http" {
+		if host := uri.Hostname(); host == "localhost" || net.ParseIP(host).IsLoopback() {
+			return nil
+		}
+	}
+	return fmt.Errorf("Redirect URI %q must use https", rawURI)
+}
+
+// handlerCreateOAuthClient registers a third-party app. The client secret
+// of a confidential client is only stored as a hash, so this is the only
+// time it can be seen.
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	type response struct {
+		oauthClient
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxOAuthClientNameLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Name must be between 1 and %d characters", maxOAuthClientNameLength))
+		return
+	}
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxRedirectURIs {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Between 1 and %d redirect URIs are required", maxRedirectURIs))
+		return
+	}
+	for _, redirectURI := range params.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		var err error
+		secret, err = auth.MakeRandomToken()
+		if err != nil {
+			log.Printf("Unable to create client secret: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	dbClient, err := cfg.dbQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userId,
+		Name:         name,
+		RedirectUris: params.RedirectURIs,
+		SecretHash:   secretHash,
+	})
+	if err != nil {
+		log.Printf("Unable to create OAuth client: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, response{
+		oauthClient:  oauthClientFromDatabase(dbClient),
+		ClientSecret: secret,
+	})
+}
+
+func (cfg *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbClients, err := cfg.dbQueries.GetOAuthClientsByOwner(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch OAuth clients: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	clients := []oauthClient{}
+	for _, dbClient := range dbClients {
+		clients = append(clients, oauthClientFromDatabase(dbClient))
+	}
+
+	respondWithJson(w, http.StatusOK, clients)
+}
+
+// handlerDeleteOAuthClient removes a third-party app together with every
+// authorization users granted it.
+func (cfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	clientId, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	rows, err := cfg.dbQueries.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientId,
+		OwnerID: userId,
+	})
+	if err != nil {
+		log.Printf("Unable to delete OAuth client: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticateOAuthClient identifies the client making a token or
+// revocation request, by HTTP basic authentication or the client_id and
+// client_secret form fields, writing an invalid_client error if it cannot.
+// Public clients only send their ID.
+func (cfg *apiConfig) authenticateOAuthClient(w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	clientIdParam, secret, ok := r.BasicAuth()
+	if !ok {
+		clientIdParam = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	invalidClient := func() {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+
+	clientId, err := uuid.Parse(clientIdParam)
+	if err != nil {
+		invalidClient()
+		return database.OauthClient{}, false
+	}
+	dbClient, err := cfg.dbQueries.GetOAuthClient(r.Context(), clientId)
+	if errors.Is(err, sql.ErrNoRows) {
+		invalidClient()
+		return database.OauthClient{}, false
+	}
+	if err != nil {
+		log.Printf("Unable to fetch OAuth client: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError))
+		return database.OauthClient{}, false
+	}
+
+	if dbClient.SecretHash.Valid != (secret != "") {
+		invalidClient()
+		return database.OauthClient{}, false
+	}
+	if dbClient.SecretHash.Valid && !auth.CheckTokenHash(secret, dbClient.SecretHash.String) {
+		invalidClient()
+		return database.OauthClient{}, false
+	}
+	return dbClient, true
+}
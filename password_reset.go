@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/mailer"
+)
+
+const passwordResetExpiresIn time.Duration = time.Hour
+
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	// The lookup happens after responding so neither the status code nor the
+	// response time reveals whether an account exists for the email.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := cfg.sendPasswordResetEmail(ctx, params.Email); err != nil {
+			log.Printf("Unable to send password reset email: %s", err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, email string) error {
+	dbUser, err := cfg.dbQueries.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.MakeRandomToken()
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.dbQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetExpiresIn),
+	}); err != nil {
+		return err
+	}
+
+	cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Use this code to choose a new password:\n\n%s\n\nThe code expires in %s. If you did not ask for a password reset you can ignore this email.\n",
+			token, passwordResetExpiresIn,
+		),
+	})
+	return nil
+}
+
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if err := validatePassword(params.Password); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		log.Printf("Unable to hash password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	userId, err := qtx.UsePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to use password reset token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if _, err := qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             userId,
+	}); err != nil {
+		log.Printf("Unable to update password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := qtx.InvalidatePasswordResetTokens(r.Context(), userId); err != nil {
+		log.Printf("Unable to invalidate password reset tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := revokeAllTokens(r.Context(), qtx, userId); err != nil {
+		log.Printf("Unable to revoke tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit password reset: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
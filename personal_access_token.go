@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxPersonalAccessTokenNameLength int = 100
+
+// personalAccessToken is a long-lived token a user created for a bot or a
+// script. The token itself is only stored as a hash.
+type personalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func personalAccessTokenFromDatabase(dbToken database.PersonalAccessToken) personalAccessToken {
+	token := personalAccessToken{
+		ID:        dbToken.ID,
+		CreatedAt: dbToken.CreatedAt,
+		Name:      dbToken.Name,
+		Scopes:    dbToken.Scopes,
+	}
+	if dbToken.ExpiresAt.Valid {
+		token.ExpiresAt = &dbToken.ExpiresAt.Time
+	}
+	if dbToken.LastUsedAt.Valid {
+		token.LastUsedAt = &dbToken.LastUsedAt.Time
+	}
+	return token
+}
+
+// handlerCreatePersonalAccessToken creates a personal access token limited
+// to the requested scopes. The response is the only time the token can be
+// seen.
+func (cfg *apiConfig) handlerCreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	type response struct {
+		personalAccessToken
+		Token string `json:"token"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxPersonalAccessTokenNameLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Name must be between 1 and %d characters", maxPersonalAccessTokenNameLength))
+		return
+	}
+
+	scopes, err := auth.ParseScopes(strings.Join(params.Scopes, " "))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			respondWithError(w, http.StatusBadRequest, "Expiry must be in the future")
+			return
+		}
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		log.Printf("Unable to create personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	dbToken, err := cfg.dbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userId,
+		Name:      name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("Unable to store personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, response{
+		personalAccessToken: personalAccessTokenFromDatabase(dbToken),
+		Token:               token,
+	})
+}
+
+// handlerGetPersonalAccessTokens lists the caller's personal access tokens
+// that have not been revoked, newest first. Expired tokens are included so
+// they can be told apart from revoked ones.
+func (cfg *apiConfig) handlerGetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbTokens, err := cfg.dbQueries.GetPersonalAccessTokensForUser(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch personal access tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	tokens := []personalAccessToken{}
+	for _, dbToken := range dbTokens {
+		tokens = append(tokens, personalAccessTokenFromDatabase(dbToken))
+	}
+
+	respondWithJson(w, http.StatusOK, tokens)
+}
+
+// revokeAllTokens signs a user out everywhere by revoking their refresh
+// tokens and personal access tokens, for example when their password
+// changes. Access tokens stay valid until they expire.
+func revokeAllTokens(ctx context.Context, q *database.Queries, userId uuid.UUID) error {
+	if err := q.RevokeAllRefreshTokensForUser(ctx, userId); err != nil {
+		return err
+	}
+	return q.RevokeAllPersonalAccessTokensForUser(ctx, userId)
+}
+
+func (cfg *apiConfig) handlerRevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	tokenId, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	rows, err := cfg.dbQueries.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenId,
+		UserID: userId,
+	})
+	if err != nil {
+		log.Printf("Unable to revoke personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
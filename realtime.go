@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"example.com/chirpy/internal/events"
+	"example.com/chirpy/internal/stream"
+	"github.com/google/uuid"
+)
+
+// streamEventTypes maps the bus events relayed to cfg.stream to the type
+// they are streamed as.
+var streamEventTypes = map[string]string{
+	events.ChirpCreated:        streamEventChirp,
+	events.ChirpDeleted:        streamEventChirpDeleted,
+	events.NotificationCreated: streamEventNotification,
+	events.MessageCreated:      streamEventMessage,
+	events.UserUpgraded:        streamEventUserUpgraded,
+}
+
+// publishEvent publishes v as an event on the event bus, from where every
+// instance relays it to its own stream subscribers. Failures are logged
+// rather than returned so that they never fail the action that caused them.
+func (cfg *apiConfig) publishEvent(ctx context.Context, eventType string, v any, audience []uuid.UUID) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Unable to marshal %s event: %s", eventType, err)
+		return
+	}
+
+	if err := cfg.events.Publish(ctx, events.Event{
+		Type:     eventType,
+		Data:     data,
+		Audience: audience,
+	}); err != nil {
+		log.Printf("Unable to publish %s event: %s", eventType, err)
+	}
+}
+
+// relayEvent hands an event received from the bus to local stream
+// subscribers.
+func (cfg *apiConfig) relayEvent(event events.Event) {
+	streamType, ok := streamEventTypes[event.Type]
+	if !ok {
+		return
+	}
+
+	streamEvent := stream.Event{
+		ID:       event.ID,
+		Type:     streamType,
+		Data:     event.Data,
+		Audience: event.Audience,
+	}
+	if event.Type == events.ChirpCreated || event.Type == events.ChirpDeleted {
+		var c chirp
+		if err := json.Unmarshal(event.Data, &c); err != nil {
+			log.Printf("Unable to decode %s event: %s", event.Type, err)
+			return
+		}
+		streamEvent.AuthorID = c.UserID
+		streamEvent.Tags = parseHashtags(c.Body)
+	}
+	cfg.stream.Publish(streamEvent)
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerRevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
@@ -15,7 +19,7 @@ func (cfg *apiConfig) handlerRevokeRefreshToken(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := cfg.dbQueries.RevokeRefreshToken(r.Context(), bearer); err != nil {
+	if err := cfg.dbQueries.RevokeRefreshToken(r.Context(), auth.HashToken(bearer)); err != nil {
 		log.Printf("Unable to revoke refresh token: %s", err)
 		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
@@ -24,9 +28,51 @@ func (cfg *apiConfig) handlerRevokeRefreshToken(w http.ResponseWriter, r *http.R
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// issueRefreshToken stores a new refresh token for the user in the given
+// token family and returns it. Only the token's hash is stored, together
+// with the device the request came from.
+func issueRefreshToken(r *http.Request, q *database.Queries, userId, familyId uuid.UUID, deviceName string) (string, error) {
+	return storeRefreshToken(r, q, database.CreateRefreshTokenParams{
+		UserID:     userId,
+		FamilyID:   familyId,
+		DeviceName: deviceName,
+	})
+}
+
+// storeRefreshToken creates a refresh token with the user, family, device
+// name and, for third-party apps, client and scopes of arg, and returns it.
+func storeRefreshToken(r *http.Request, q *database.Queries, arg database.CreateRefreshTokenParams) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	arg.TokenHash = auth.HashToken(refreshToken)
+	arg.ExpiresAt = time.Now().UTC().Add(refreshTokenExpiresIn)
+	arg.UserAgent = userAgent
+	arg.IpAddress = clientIP(r)
+	if arg.Scopes == nil {
+		arg.Scopes = []string{}
+	}
+	if _, err := q.CreateRefreshToken(r.Context(), arg); err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// handlerUpdateRefreshToken exchanges a refresh token for a new access token
+// and a new refresh token. The old refresh token is retired. Every token
+// issued from the same login forms a family, and presenting a retired token
+// means it was copied, so the whole family is revoked.
 func (cfg *apiConfig) handlerUpdateRefreshToken(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	bearer, err := auth.GetBearerToken(r.Header)
@@ -36,18 +82,97 @@ func (cfg *apiConfig) handlerUpdateRefreshToken(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	userId, err := cfg.dbQueries.GetUserFromRefreshToken(r.Context(), bearer)
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
 	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	dbToken, err := qtx.GetRefreshTokenForUpdate(r.Context(), auth.HashToken(bearer))
+	if err != nil || !auth.CheckTokenHash(bearer, dbToken.TokenHash) {
+		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if dbToken.RevokedAt.Valid || dbToken.ExpiresAt.Before(time.Now()) {
+		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	// Refresh tokens of third-party apps are exchanged at /oauth/token,
+	// which keeps their scopes.
+	if dbToken.ClientID.Valid {
+		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	if dbToken.RotatedAt.Valid {
+		if err := qtx.RevokeRefreshTokenFamily(r.Context(), dbToken.FamilyID); err != nil {
+			log.Printf("Unable to revoke refresh token family: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := recordSecurityEvent(r, qtx, dbToken.UserID, securityEventRefreshTokenReuse,
+			fmt.Sprintf("Token family %s revoked", dbToken.FamilyID)); err != nil {
+			log.Printf("Unable to record security event: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("Unable to commit refresh token revocation: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		log.Printf("Retired refresh token reused for user %s, revoked token family %s", dbToken.UserID, dbToken.FamilyID)
 		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 
-	newAccessToken, err := auth.MakeJWT(userId, cfg.jwtSecret, accessTokenExpiresIn)
+	dbUser, err := qtx.GetUserByID(r.Context(), dbToken.UserID)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if restriction := accountRestriction(dbUser); restriction != "" {
+		respondWithError(w, http.StatusForbidden, restriction)
+		return
+	}
+
+	if err := qtx.RotateRefreshToken(r.Context(), dbToken.TokenHash); err != nil {
+		log.Printf("Unable to retire refresh token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	refreshToken, err := issueRefreshToken(r, qtx, dbUser.ID, dbToken.FamilyID, dbToken.DeviceName)
+	if err != nil {
+		log.Printf("Unable to create refresh token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	newAccessToken, err := auth.MakeJWT(auth.Claims{
+		UserID:    dbUser.ID,
+		Role:      dbUser.Role,
+		SessionID: dbToken.FamilyID,
+	}, cfg.jwtKeys, accessTokenExpiresIn)
 	if err != nil {
 		log.Printf("Unable to create new access token: %s", err)
 		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	respondWithJson(w, http.StatusOK, response{newAccessToken})
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit refresh token rotation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, response{
+		Token:        newAccessToken,
+		RefreshToken: refreshToken,
+	})
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxReportDetailsLength int = 1000
+
+var reportCategories = []string{
+	"spam",
+	"harassment",
+	"hate",
+	"violence",
+	"self_harm",
+	"impersonation",
+	"other",
+}
+
+type report struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReporterID     uuid.UUID  `json:"reporter_id"`
+	ReportedUserID uuid.UUID  `json:"reported_user_id"`
+	ChirpID        *uuid.UUID `json:"chirp_id"`
+	ChirpBody      *string    `json:"chirp_body"`
+	Category       string     `json:"category"`
+	Details        string     `json:"details"`
+	Status         string     `json:"status"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+}
+
+func reportFromDatabase(dbReport database.Report) report {
+	result := report{
+		ID:             dbReport.ID,
+		CreatedAt:      dbReport.CreatedAt,
+		ReporterID:     dbReport.ReporterID,
+		ReportedUserID: dbReport.ReportedUserID,
+		Category:       dbReport.Category,
+		Details:        dbReport.Details,
+		Status:         dbReport.Status,
+	}
+	if dbReport.ChirpID.Valid {
+		result.ChirpID = &dbReport.ChirpID.UUID
+	}
+	if dbReport.ChirpBody.Valid {
+		result.ChirpBody = &dbReport.ChirpBody.String
+	}
+	if dbReport.ResolvedAt.Valid {
+		result.ResolvedAt = &dbReport.ResolvedAt.Time
+	}
+	return result
+}
+
+func (cfg *apiConfig) handlerReportChirp(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	dbChirp, err := cfg.dbQueries.GetChirp(r.Context(), chirpId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	// The body is kept with the report so it can still be reviewed if the
+	// chirp is deleted in the meantime.
+	cfg.createReport(w, r, database.CreateReportParams{
+		ReporterID:     userId,
+		ReportedUserID: dbChirp.UserID,
+		ChirpID:        uuid.NullUUID{UUID: dbChirp.ID, Valid: true},
+		ChirpBody:      sql.NullString{String: dbChirp.Body, Valid: true},
+	})
+}
+
+func (cfg *apiConfig) handlerReportUser(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	reportedUserId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if _, err := cfg.dbQueries.GetUserByID(r.Context(), reportedUserId); err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	cfg.createReport(w, r, database.CreateReportParams{
+		ReporterID:     userId,
+		ReportedUserID: reportedUserId,
+	})
+}
+
+// createReport completes report with the category and details in the
+// request body and stores it.
+func (cfg *apiConfig) createReport(w http.ResponseWriter, r *http.Request, params database.CreateReportParams) {
+	type parameters struct {
+		Category string `json:"category"`
+		Details  string `json:"details"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var body parameters
+	if err := decoder.Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if !slices.Contains(reportCategories, body.Category) {
+		respondWithError(w, http.StatusBadRequest, "Unknown report category")
+		return
+	}
+	if len(body.Details) > maxReportDetailsLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Details must be at most %d characters", maxReportDetailsLength))
+		return
+	}
+	if params.ReportedUserID == params.ReporterID {
+		respondWithError(w, http.StatusBadRequest, "You cannot report yourself")
+		return
+	}
+
+	exists, err := cfg.dbQueries.HasOpenReport(r.Context(), database.HasOpenReportParams{
+		ReporterID:     params.ReporterID,
+		ReportedUserID: params.ReportedUserID,
+		ChirpID:        params.ChirpID,
+	})
+	if err != nil {
+		log.Printf("Unable to check for open reports: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if exists {
+		respondWithError(w, http.StatusConflict, "You have already reported this")
+		return
+	}
+
+	params.Category = body.Category
+	params.Details = body.Details
+	dbReport, err := cfg.dbQueries.CreateReport(r.Context(), params)
+	if err != nil {
+		log.Printf("Unable to create report: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, reportFromDatabase(dbReport))
+}
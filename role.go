@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// requireRole only passes requests on to next when their principal has at
+// least role. It has to be wrapped in authenticated. The role is read from
+// the access token, so a change of role takes effect once the user's
+// current access token expires.
+func (cfg *apiConfig) requireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.HasRole(principalFromContext(r.Context()).Role, role) {
+			respondWithError(w, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlerSetUserRole changes the role of another user. Admins cannot change
+// their own role so that there is always at least one admin left.
+func (cfg *apiConfig) handlerSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	adminId := principalFromContext(r.Context()).UserID
+
+	userId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	if userId == adminId {
+		respondWithError(w, http.StatusBadRequest, "You cannot change your own role")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if !auth.HasRole(params.Role, auth.RoleUser) {
+		respondWithError(w, http.StatusBadRequest, "Unknown role")
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.SetUserRole(r.Context(), database.SetUserRoleParams{
+		Role: params.Role,
+		ID:   userId,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, cfg.userFromDatabase(dbUser))
+}
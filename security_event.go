@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Types of security events recorded for an account.
+const (
+	securityEventRefreshTokenReuse string = "refresh_token_reuse"
+	securityEventTwoFactorEnabled  string = "two_factor_enabled"
+	securityEventTwoFactorDisabled string = "two_factor_disabled"
+	securityEventRecoveryCodeUsed  string = "recovery_code_used"
+	securityEventLoginLockout      string = "login_lockout"
+)
+
+// clientIP returns the address the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// recordSecurityEvent stores a security event for the user caused by r.
+func recordSecurityEvent(r *http.Request, q *database.Queries, userId uuid.UUID, eventType, details string) error {
+	return q.CreateSecurityEvent(r.Context(), database.CreateSecurityEventParams{
+		UserID:    userId,
+		Type:      eventType,
+		IpAddress: clientIP(r),
+		Details:   details,
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxDeviceNameLength int = 100
+const maxUserAgentLength int = 512
+
+// session is a login on one device. Its ID is the ID of the refresh token
+// family issued for the login.
+type session struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// handlerGetSessions lists the caller's active sessions, most recently used
+// first.
+func (cfg *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	caller := principalFromContext(r.Context())
+
+	dbSessions, err := cfg.dbQueries.GetSessions(r.Context(), caller.UserID)
+	if err != nil {
+		log.Printf("Unable to fetch sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	sessions := []session{}
+	for _, dbSession := range dbSessions {
+		sessions = append(sessions, session{
+			ID:         dbSession.FamilyID,
+			DeviceName: dbSession.DeviceName,
+			UserAgent:  dbSession.UserAgent,
+			IPAddress:  dbSession.IpAddress,
+			SignedInAt: dbSession.SignedInAt,
+			LastUsedAt: dbSession.LastUsedAt,
+			Current:    dbSession.FamilyID == caller.SessionID,
+		})
+	}
+
+	respondWithJson(w, http.StatusOK, sessions)
+}
+
+// handlerRevokeSession signs one of the caller's devices out. Access tokens
+// already issued to it stay valid until they expire.
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	sessionId, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	revoked, err := cfg.dbQueries.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionId,
+		UserID:   userId,
+	})
+	if err != nil {
+		log.Printf("Unable to revoke session: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerRevokeOtherSessions signs the caller out everywhere except on the
+// device the request comes from.
+func (cfg *apiConfig) handlerRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	caller := principalFromContext(r.Context())
+
+	// Access tokens issued before sessions existed do not say which session
+	// they belong to.
+	if caller.SessionID == uuid.Nil {
+		respondWithError(w, http.StatusBadRequest, "Unknown current session, refresh your access token")
+		return
+	}
+
+	if err := cfg.dbQueries.RevokeOtherSessions(r.Context(), database.RevokeOtherSessionsParams{
+		UserID:   caller.UserID,
+		FamilyID: caller.SessionID,
+	}); err != nil {
+		log.Printf("Unable to revoke sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -18,3 +18,23 @@ SELECT * FROM chirps WHERE id = $1;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps WHERE id = $1;
+
+-- name: GetChirpsByUser :many
+SELECT * FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: CreateChirpAt :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: CountChirpsByUser :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1;
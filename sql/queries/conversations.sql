@@ -0,0 +1,61 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at, created_by, is_group, direct_key)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: GetConversation :one
+SELECT * FROM conversations WHERE id = $1;
+
+-- name: GetDirectConversation :one
+SELECT * FROM conversations WHERE direct_key = $1;
+
+-- name: TouchConversation :exec
+UPDATE conversations SET
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: AddConversationMember :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at, last_read_at)
+VALUES ($1, $2, NOW(), NULL);
+
+-- name: GetConversationMember :one
+SELECT * FROM conversation_members
+WHERE conversation_id = $1
+AND user_id = $2;
+
+-- name: GetConversationMemberIDs :many
+SELECT user_id FROM conversation_members
+WHERE conversation_id = $1
+ORDER BY joined_at ASC, user_id ASC;
+
+-- name: GetConversationsForUser :many
+SELECT
+    conversations.id,
+    conversations.created_at,
+    conversations.updated_at,
+    conversations.created_by,
+    conversations.is_group,
+    conversation_members.last_read_at,
+    (
+        SELECT COUNT(*) FROM messages
+        WHERE messages.conversation_id = conversations.id
+        AND messages.sender_id <> conversation_members.user_id
+        AND (conversation_members.last_read_at IS NULL OR messages.created_at > conversation_members.last_read_at)
+    )::bigint AS unread_count
+FROM conversations
+INNER JOIN conversation_members ON conversation_members.conversation_id = conversations.id
+WHERE conversation_members.user_id = $1
+ORDER BY conversations.updated_at DESC;
+
+-- name: MarkConversationRead :exec
+UPDATE conversation_members SET
+    last_read_at = GREATEST(COALESCE(last_read_at, sqlc.arg(read_at)::timestamp), sqlc.arg(read_at)::timestamp)
+WHERE conversation_id = sqlc.arg(conversation_id)
+AND user_id = sqlc.arg(user_id);
@@ -0,0 +1,34 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, updated_at, user_id, status)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    'pending'
+)
+RETURNING *;
+
+-- name: GetDataExport :one
+SELECT * FROM data_exports WHERE id = $1;
+
+-- name: StartDataExport :exec
+UPDATE data_exports SET
+    status = 'running',
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports SET
+    status = 'completed',
+    file_key = $1,
+    completed_at = NOW(),
+    updated_at = NOW()
+WHERE id = $2;
+
+-- name: FailDataExport :exec
+UPDATE data_exports SET
+    status = 'failed',
+    error = $1,
+    updated_at = NOW()
+WHERE id = $2;
@@ -0,0 +1,73 @@
+-- name: CreateImport :one
+INSERT INTO imports (id, created_at, updated_at, user_id, source, status, total)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    'pending',
+    $3
+)
+RETURNING *;
+
+-- name: GetImport :one
+SELECT * FROM imports WHERE id = $1;
+
+-- name: StartImport :exec
+UPDATE imports SET
+    status = 'running',
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateImportProgress :exec
+UPDATE imports SET
+    processed = $1,
+    imported = $2,
+    updated_at = NOW()
+WHERE id = $3;
+
+-- name: CompleteImport :exec
+UPDATE imports SET
+    status = 'completed',
+    processed = $1,
+    imported = $2,
+    completed_at = NOW(),
+    updated_at = NOW()
+WHERE id = $3;
+
+-- name: FailImport :exec
+UPDATE imports SET
+    status = 'failed',
+    error = $1,
+    updated_at = NOW()
+WHERE id = $2;
+
+-- name: FailStaleImports :execrows
+UPDATE imports SET
+    status = 'failed',
+    error = sqlc.arg(error),
+    updated_at = NOW()
+WHERE status IN ('pending', 'running')
+AND updated_at < sqlc.arg(stale_before)::timestamp;
+
+-- name: CreateImportSkip :exec
+INSERT INTO import_skips (import_id, source_id, reason, created_at)
+VALUES ($1, $2, $3, NOW());
+
+-- name: GetImportSkips :many
+SELECT * FROM import_skips
+WHERE import_id = $1
+ORDER BY created_at ASC;
+
+-- name: ClaimImportedChirp :execrows
+INSERT INTO imported_chirps (user_id, source, source_id, chirp_id, created_at)
+VALUES ($1, $2, $3, NULL, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: SetImportedChirpID :exec
+UPDATE imported_chirps SET
+    chirp_id = $1
+WHERE user_id = $2
+AND source = $3
+AND source_id = $4;
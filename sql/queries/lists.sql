@@ -0,0 +1,91 @@
+-- name: CreateList :one
+INSERT INTO lists (id, created_at, updated_at, owner_id, name, description, is_private)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetList :one
+SELECT * FROM lists WHERE id = $1;
+
+-- name: GetListsByOwner :many
+SELECT * FROM lists
+WHERE owner_id = $1
+ORDER BY created_at ASC;
+
+-- name: CountListsByOwner :one
+SELECT COUNT(*) FROM lists WHERE owner_id = $1;
+
+-- name: UpdateList :one
+UPDATE lists SET
+    name = $1,
+    description = $2,
+    is_private = $3,
+    updated_at = NOW()
+WHERE id = $4
+RETURNING *;
+
+-- name: DeleteList :exec
+DELETE FROM lists WHERE id = $1;
+
+-- name: AddListMember :exec
+INSERT INTO list_members (list_id, user_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveListMember :exec
+DELETE FROM list_members
+WHERE list_id = $1
+AND user_id = $2;
+
+-- name: IsListMember :one
+SELECT EXISTS (
+    SELECT 1 FROM list_members
+    WHERE list_id = $1
+    AND user_id = $2
+);
+
+-- name: CountListMembers :one
+SELECT COUNT(*) FROM list_members WHERE list_id = $1;
+
+-- name: GetListMembers :many
+SELECT users.* FROM users
+INNER JOIN list_members ON list_members.user_id = users.id
+WHERE list_members.list_id = $1
+ORDER BY list_members.created_at ASC;
+
+-- name: SubscribeToList :exec
+INSERT INTO list_subscriptions (list_id, user_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnsubscribeFromList :exec
+DELETE FROM list_subscriptions
+WHERE list_id = $1
+AND user_id = $2;
+
+-- name: DeleteListSubscriptions :exec
+DELETE FROM list_subscriptions WHERE list_id = $1;
+
+-- name: GetSubscribedLists :many
+SELECT lists.* FROM lists
+INNER JOIN list_subscriptions ON list_subscriptions.list_id = lists.id
+WHERE list_subscriptions.user_id = $1
+ORDER BY list_subscriptions.created_at ASC;
+
+-- name: GetListTimeline :many
+SELECT chirps.* FROM chirps
+INNER JOIN list_members ON list_members.user_id = chirps.user_id
+WHERE list_members.list_id = sqlc.arg(list_id)
+AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg(before_created_at)::timestamp, sqlc.narg(before_id)::uuid)
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(max_results);
@@ -0,0 +1,31 @@
+-- name: CreateLoginFailures :exec
+INSERT INTO login_failures (key, failures, last_failed_at)
+SELECT unnest(sqlc.arg(keys)::text[]), 0, sqlc.arg(created_at)::timestamp
+ON CONFLICT (key) DO NOTHING;
+
+-- name: DeleteLoginFailures :exec
+DELETE FROM login_failures
+WHERE key = $1;
+
+-- name: GetLoginFailuresForUpdate :many
+SELECT * FROM login_failures
+WHERE key = ANY(sqlc.arg(keys)::text[])
+ORDER BY key
+FOR UPDATE;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (key, failures, last_failed_at)
+VALUES (sqlc.arg(key), 1, sqlc.arg(failed_at))
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_failures.last_failed_at > sqlc.arg(window_start) THEN login_failures.failures + 1
+        ELSE 1
+    END,
+    last_failed_at = EXCLUDED.last_failed_at
+RETURNING *;
+
+-- name: ReleaseLoginFailures :exec
+UPDATE login_failures
+SET failures = failures - 1
+WHERE key = ANY(sqlc.arg(keys)::text[])
+AND failures > 0;
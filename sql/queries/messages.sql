@@ -0,0 +1,23 @@
+-- name: CreateMessage :one
+INSERT INTO messages (id, created_at, conversation_id, sender_id, body)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: GetMessage :one
+SELECT * FROM messages WHERE id = $1;
+
+-- name: GetMessages :many
+SELECT * FROM messages
+WHERE conversation_id = sqlc.arg(conversation_id)
+AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(before_created_at)::timestamp, sqlc.narg(before_id)::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(max_results);
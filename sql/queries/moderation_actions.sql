@@ -0,0 +1,24 @@
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id, created_at, report_id, moderator_id, target_user_id, chirp_id, action, reason, suspended_until)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+RETURNING *;
+
+-- name: GetModerationActionsForReport :many
+SELECT * FROM moderation_actions
+WHERE report_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetModerationActionsForUser :many
+SELECT * FROM moderation_actions
+WHERE target_user_id = $1
+ORDER BY created_at DESC;
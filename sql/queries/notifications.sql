@@ -0,0 +1,58 @@
+-- name: CreateOrGroupNotification :one
+INSERT INTO notifications (id, created_at, updated_at, user_id, type, subject_id, actor_ids, read_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    sqlc.arg(user_id),
+    sqlc.arg(type),
+    sqlc.arg(subject_id),
+    ARRAY[sqlc.arg(actor_id)::uuid],
+    NULL
+)
+ON CONFLICT (user_id, type, subject_id) WHERE read_at IS NULL DO UPDATE SET
+    updated_at = NOW(),
+    actor_ids = CASE
+        WHEN sqlc.arg(actor_id)::uuid = ANY(notifications.actor_ids) THEN notifications.actor_ids
+        ELSE array_append(notifications.actor_ids, sqlc.arg(actor_id)::uuid)
+    END
+RETURNING *;
+
+-- name: GetNotifications :many
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg(user_id)
+AND (NOT sqlc.arg(unread_only)::bool OR read_at IS NULL)
+ORDER BY updated_at DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: MarkNotificationsRead :exec
+UPDATE notifications SET
+    read_at = NOW()
+WHERE user_id = sqlc.arg(user_id)
+AND id = ANY(sqlc.arg(ids)::uuid[])
+AND read_at IS NULL;
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications SET
+    read_at = NOW()
+WHERE user_id = $1
+AND read_at IS NULL;
+
+-- name: GetNotificationPreferences :many
+SELECT * FROM notification_preferences
+WHERE user_id = $1;
+
+-- name: IsNotificationDisabled :one
+SELECT EXISTS (
+    SELECT 1 FROM notification_preferences
+    WHERE user_id = $1
+    AND type = $2
+    AND NOT enabled
+);
+
+-- name: SetNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, type, enabled, updated_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id, type) DO UPDATE SET
+    enabled = EXCLUDED.enabled,
+    updated_at = NOW();
@@ -0,0 +1,59 @@
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+    code_hash,
+    created_at,
+    client_id,
+    user_id,
+    redirect_uri,
+    scopes,
+    code_challenge,
+    expires_at,
+    redirect_uri_provided
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+);
+
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, updated_at, owner_id, name, redirect_uris, secret_hash)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1
+AND owner_id = $2;
+
+-- name: GetOAuthAuthorizationCodeForUpdate :one
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash = $1
+FOR UPDATE;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: GetOAuthClientsByOwner :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at;
+
+-- name: UseOAuthAuthorizationCode :exec
+UPDATE oauth_authorization_codes
+SET used_at = NOW(), family_id = $2
+WHERE code_hash = $1;
@@ -0,0 +1,28 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (
+    token_hash,
+    created_at,
+    user_id,
+    expires_at,
+    used_at
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    NULL
+);
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+AND used_at IS NULL;
@@ -1,29 +1,91 @@
 -- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-    token,
+    token_hash,
     created_at,
     updated_at,
     user_id,
     expires_at,
-    revoked_at
+    revoked_at,
+    family_id,
+    user_agent,
+    ip_address,
+    device_name,
+    last_used_at,
+    client_id,
+    scopes
 ) VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
     $3,
-    NULL
+    NULL,
+    $4,
+    $5,
+    $6,
+    $7,
+    NOW(),
+    $8,
+    $9
 )
 RETURNING *;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: GetRefreshTokenForUpdate :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: RotateRefreshToken :exec
+UPDATE refresh_tokens
+SET rotated_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
 
--- name: GetUserFromRefreshToken :one
-SELECT users.id FROM refresh_tokens
-INNER JOIN users on users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+-- name: GetSessions :many
+SELECT
+    refresh_tokens.family_id,
+    refresh_tokens.device_name,
+    refresh_tokens.user_agent,
+    refresh_tokens.ip_address,
+    (
+        SELECT MIN(first.created_at) FROM refresh_tokens AS first
+        WHERE first.family_id = refresh_tokens.family_id
+    )::timestamp AS signed_in_at,
+    refresh_tokens.last_used_at
+FROM refresh_tokens
+WHERE refresh_tokens.user_id = $1
 AND refresh_tokens.revoked_at IS NULL
-AND refresh_tokens.expires_at > NOW();
+AND refresh_tokens.rotated_at IS NULL
+AND refresh_tokens.expires_at > NOW()
+ORDER BY refresh_tokens.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND user_id = $2
+AND revoked_at IS NULL
+AND expires_at > NOW();
+
+-- name: RevokeOtherSessions :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND family_id <> $2
+AND revoked_at IS NULL;
@@ -0,0 +1,46 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, reporter_id, reported_user_id, chirp_id, chirp_body, category, details, status, resolved_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    'open',
+    NULL
+)
+RETURNING *;
+
+-- name: GetReport :one
+SELECT * FROM reports WHERE id = $1;
+
+-- name: HasOpenReport :one
+SELECT EXISTS (
+    SELECT 1 FROM reports
+    WHERE reporter_id = sqlc.arg(reporter_id)
+    AND reported_user_id = sqlc.arg(reported_user_id)
+    AND chirp_id IS NOT DISTINCT FROM sqlc.narg(chirp_id)
+    AND status = 'open'
+);
+
+-- name: GetReportsByStatus :many
+SELECT * FROM reports
+WHERE status = $1
+ORDER BY created_at ASC
+LIMIT $2;
+
+-- name: ResolveReport :exec
+UPDATE reports SET
+    status = 'resolved',
+    resolved_at = NOW()
+WHERE id = $1;
+
+-- name: ResolveOpenReportsForChirp :exec
+UPDATE reports SET
+    status = 'resolved',
+    resolved_at = NOW()
+WHERE chirp_id = $1
+AND status = 'open';
@@ -0,0 +1,73 @@
+-- name: ConfirmTOTPCredential :exec
+UPDATE totp_credentials
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1;
+
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (token_hash, created_at, user_id, device_name, expires_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+);
+
+-- name: CreateRecoveryCodes :exec
+INSERT INTO recovery_codes (user_id, code_hash, created_at)
+SELECT sqlc.arg(user_id), unnest(sqlc.arg(code_hashes)::text[]), NOW();
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: DeleteTOTPCredential :exec
+DELETE FROM totp_credentials
+WHERE user_id = $1;
+
+-- name: GetLoginChallengeForUpdate :one
+SELECT * FROM login_challenges
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: GetTOTPCredential :one
+SELECT * FROM totp_credentials
+WHERE user_id = $1;
+
+-- name: GetTOTPCredentialForUpdate :one
+SELECT * FROM totp_credentials
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: IncrementLoginChallengeAttempts :exec
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1;
+
+-- name: UpsertPendingTOTPCredential :execrows
+INSERT INTO totp_credentials (user_id, created_at, secret)
+VALUES (
+    $1,
+    NOW(),
+    $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET created_at = NOW(), secret = EXCLUDED.secret, last_used_step = 0
+WHERE totp_credentials.confirmed_at IS NULL;
+
+-- name: UseLoginChallenge :exec
+UPDATE login_challenges
+SET used_at = NOW()
+WHERE token_hash = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1
+AND code_hash = $2
+AND used_at IS NULL;
+
+-- name: UseTOTPStep :exec
+UPDATE totp_credentials
+SET last_used_step = $2
+WHERE user_id = $1;
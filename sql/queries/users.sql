@@ -16,12 +16,22 @@ DELETE FROM users;
 -- name: GetUserByEmail :one
 SELECT * FROM users where email = $1;
 
--- name: UpdateUser :one
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: UpdateUserEmail :one
 UPDATE users SET
     email = $1,
-    hashed_password = $2,
+    email_verified_at = NULL,
     updated_at = NOW()
-WHERE id = $3
+WHERE id = $2
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users SET
+    hashed_password = $1,
+    updated_at = NOW()
+WHERE id = $2
 RETURNING *;
 
 -- name: EnableChirpyRed :exec
@@ -29,3 +39,123 @@ UPDATE users SET
     is_chirpy_red = true,
     updated_at = NOW()
 WHERE id = $1;
+
+-- name: SetUserEmailVerified :exec
+UPDATE users SET
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateUserAvatar :one
+UPDATE users SET
+    avatar_key = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: UpdateUserBanner :one
+UPDATE users SET
+    banner_key = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: UpdateUserProfile :one
+UPDATE users SET
+    handle = $1,
+    display_name = $2,
+    updated_at = NOW()
+WHERE id = $3
+RETURNING *;
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE handle IS NOT NULL
+AND (
+    handle ILIKE '%' || sqlc.arg(pattern)::text || '%'
+    OR display_name ILIKE '%' || sqlc.arg(pattern)::text || '%'
+)
+AND banned_at IS NULL
+AND (suspended_until IS NULL OR suspended_until < NOW())
+ORDER BY GREATEST(
+    similarity(handle, sqlc.arg(query)::text),
+    similarity(display_name, sqlc.arg(query)::text)
+) DESC, handle
+LIMIT sqlc.arg(max_results);
+
+-- name: AutocompleteHandles :many
+SELECT * FROM users
+WHERE handle ~>=~ sqlc.arg(lower_bound)::text
+AND handle ~<~ sqlc.arg(upper_bound)::text
+AND banned_at IS NULL
+AND (suspended_until IS NULL OR suspended_until < NOW())
+ORDER BY handle
+LIMIT sqlc.arg(max_results);
+
+-- name: GetUsersByHandles :many
+SELECT * FROM users
+WHERE handle = ANY(sqlc.arg(handles)::text[]);
+
+-- name: SuspendUser :exec
+UPDATE users SET
+    suspended_until = $1,
+    updated_at = NOW()
+WHERE id = $2;
+
+-- name: SetUserRole :one
+UPDATE users SET
+    role = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: PromoteFirstAdmin :one
+UPDATE users SET
+    role = 'admin',
+    updated_at = NOW()
+WHERE email = $1
+AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin')
+RETURNING *;
+
+-- name: BanUser :exec
+UPDATE users SET
+    banned_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UnbanUser :exec
+UPDATE users SET
+    banned_at = NULL,
+    suspended_until = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateLastLogin :exec
+UPDATE users SET last_login_at = NOW()
+WHERE id = $1;
+
+-- name: GetUsersForAdmin :many
+SELECT * FROM users
+WHERE (
+    sqlc.narg(pattern)::text IS NULL
+    OR email ILIKE '%' || sqlc.narg(pattern)::text || '%'
+    OR handle ILIKE '%' || sqlc.narg(pattern)::text || '%'
+)
+AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(before_created_at)::timestamp, sqlc.narg(before_id)::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: UpdateUserAllowDirectMessages :one
+UPDATE users SET
+    allow_direct_messages = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: GetUsersRefusingDirectMessages :many
+SELECT id FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[])
+AND NOT allow_direct_messages;
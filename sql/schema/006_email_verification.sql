@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+CREATE TABLE email_verification_tokens (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE users
+ADD COLUMN handle TEXT UNIQUE,
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX users_handle_prefix_idx ON users (handle text_pattern_ops);
+CREATE INDEX users_handle_trgm_idx ON users USING GIN (handle gin_trgm_ops);
+CREATE INDEX users_display_name_trgm_idx ON users USING GIN (display_name gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX users_display_name_trgm_idx;
+DROP INDEX users_handle_trgm_idx;
+DROP INDEX users_handle_prefix_idx;
+
+ALTER TABLE users
+DROP COLUMN handle,
+DROP COLUMN display_name;
@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE imports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL,
+    total INTEGER NOT NULL DEFAULT 0,
+    processed INTEGER NOT NULL DEFAULT 0,
+    imported INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    completed_at TIMESTAMP
+);
+
+CREATE TABLE import_skips (
+    import_id UUID NOT NULL REFERENCES imports ON DELETE CASCADE,
+    source_id TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE imported_chirps (
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    source_id TEXT NOT NULL,
+    chirp_id UUID REFERENCES chirps ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, source, source_id)
+);
+
+-- +goose Down
+DROP TABLE imported_chirps;
+DROP TABLE import_skips;
+DROP TABLE imports;
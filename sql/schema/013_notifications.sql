@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    subject_id UUID NOT NULL,
+    actor_ids UUID[] NOT NULL,
+    read_at TIMESTAMP
+);
+
+-- Unread notifications about the same subject are grouped into one row.
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications (user_id, type, subject_id) WHERE read_at IS NULL;
+CREATE INDEX notifications_user_id_updated_at_idx ON notifications (user_id, updated_at DESC);
+
+CREATE TABLE notification_preferences (
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
+
+-- +goose Down
+DROP TABLE notification_preferences;
+DROP TABLE notifications;
@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE lists (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    owner_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    is_private BOOLEAN NOT NULL
+);
+
+CREATE INDEX lists_owner_id_idx ON lists (owner_id);
+
+CREATE TABLE list_members (
+    list_id UUID NOT NULL REFERENCES lists ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX list_members_user_id_idx ON list_members (user_id);
+
+CREATE TABLE list_subscriptions (
+    list_id UUID NOT NULL REFERENCES lists ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX list_subscriptions_user_id_idx ON list_subscriptions (user_id);
+
+CREATE INDEX chirps_user_id_created_at_idx ON chirps (user_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX chirps_user_id_created_at_idx;
+DROP TABLE list_subscriptions;
+DROP TABLE list_members;
+DROP TABLE lists;
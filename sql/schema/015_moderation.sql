@@ -0,0 +1,38 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN suspended_until TIMESTAMP;
+
+CREATE TABLE reports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    reporter_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    reported_user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    chirp_id UUID REFERENCES chirps ON DELETE SET NULL,
+    chirp_body TEXT,
+    category TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at);
+CREATE INDEX reports_reporter_id_idx ON reports (reporter_id);
+
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    report_id UUID REFERENCES reports ON DELETE SET NULL,
+    moderator_id UUID REFERENCES users ON DELETE SET NULL,
+    target_user_id UUID REFERENCES users ON DELETE SET NULL,
+    chirp_id UUID,
+    action TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    suspended_until TIMESTAMP
+);
+
+CREATE INDEX moderation_actions_report_id_idx ON moderation_actions (report_id);
+CREATE INDEX moderation_actions_target_user_id_idx ON moderation_actions (target_user_id);
+
+-- +goose Down
+DROP TABLE moderation_actions;
+DROP TABLE reports;
+ALTER TABLE users DROP COLUMN suspended_until;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN banned_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN last_login_at TIMESTAMP;
+
+CREATE INDEX users_created_at_idx ON users (created_at, id);
+
+-- +goose Down
+DROP INDEX users_created_at_idx;
+ALTER TABLE users DROP COLUMN last_login_at;
+ALTER TABLE users DROP COLUMN banned_at;
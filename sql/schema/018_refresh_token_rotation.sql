@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID;
+UPDATE refresh_tokens SET family_id = gen_random_uuid();
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+ALTER TABLE refresh_tokens ADD COLUMN rotated_at TIMESTAMP;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+CREATE TABLE security_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX security_events_user_id_created_at_idx ON security_events (user_id, created_at);
+
+-- +goose Down
+DROP TABLE security_events;
+DROP INDEX refresh_tokens_family_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN rotated_at;
+ALTER TABLE refresh_tokens DROP COLUMN family_id;
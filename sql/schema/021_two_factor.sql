@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE totp_credentials (
+    user_id UUID PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    secret TEXT NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_used_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE recovery_codes (
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE login_challenges (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    device_name TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE login_challenges;
+DROP TABLE recovery_codes;
+DROP TABLE totp_credentials;
@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    owner_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    redirect_uris TEXT[] NOT NULL,
+    secret_hash TEXT
+);
+
+CREATE INDEX oauth_clients_owner_id_idx ON oauth_clients (owner_id);
+
+CREATE TABLE oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    client_id UUID NOT NULL REFERENCES oauth_clients ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    family_id UUID
+);
+
+ALTER TABLE refresh_tokens ADD COLUMN client_id UUID REFERENCES oauth_clients ON DELETE CASCADE;
+ALTER TABLE refresh_tokens ADD COLUMN scopes TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE refresh_tokens DROP COLUMN scopes;
+ALTER TABLE refresh_tokens DROP COLUMN client_id;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
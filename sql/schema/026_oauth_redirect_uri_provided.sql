@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE oauth_authorization_codes ADD COLUMN redirect_uri_provided BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- +goose Down
+ALTER TABLE oauth_authorization_codes DROP COLUMN redirect_uri_provided;
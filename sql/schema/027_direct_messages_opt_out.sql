@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN allow_direct_messages BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN allow_direct_messages;
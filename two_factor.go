@@ -0,0 +1,413 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/totp"
+	"github.com/google/uuid"
+)
+
+const totpIssuer string = "Chirpy"
+const recoveryCodeCount int = 10
+const loginChallengeExpiresIn time.Duration = 5 * time.Minute
+const maxLoginChallengeAttempts int32 = 5
+
+// handlerEnrollTOTP creates a new TOTP secret for the user. It only takes
+// effect once a first code has been confirmed, and enrolling again before
+// that replaces the secret.
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("Unable to create TOTP secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	rows, err := cfg.dbQueries.UpsertPendingTOTPCredential(r.Context(), database.UpsertPendingTOTPCredentialParams{
+		UserID: userId,
+		Secret: secret,
+	})
+	if err != nil {
+		log.Printf("Unable to store TOTP secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, response{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, dbUser.Email, secret),
+	})
+}
+
+// handlerConfirmTOTP enables two-factor authentication once the user shows
+// that their authenticator app produces the right codes, and responds with
+// recovery codes. The recovery codes are only stored as hashes, so this is
+// the only time they can be seen.
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	credential, err := qtx.GetTOTPCredentialForUpdate(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication has not been enrolled")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to fetch TOTP credential: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if credential.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	step, ok := totp.Validate(credential.Secret, params.Code, cfg.now(), credential.LastUsedStep)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	if err := qtx.ConfirmTOTPCredential(r.Context(), database.ConfirmTOTPCredentialParams{
+		UserID:       userId,
+		LastUsedStep: step,
+	}); err != nil {
+		log.Printf("Unable to confirm TOTP credential: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	codeHashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := auth.MakeRecoveryCode()
+		if err != nil {
+			log.Printf("Unable to create recovery code: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		recoveryCodes = append(recoveryCodes, code)
+		codeHashes = append(codeHashes, auth.HashToken(code))
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userId); err != nil {
+		log.Printf("Unable to delete recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err := qtx.CreateRecoveryCodes(r.Context(), database.CreateRecoveryCodesParams{
+		UserID:     userId,
+		CodeHashes: codeHashes,
+	}); err != nil {
+		log.Printf("Unable to store recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := recordSecurityEvent(r, qtx, userId, securityEventTwoFactorEnabled, ""); err != nil {
+		log.Printf("Unable to record security event: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit TOTP confirmation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, response{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// handlerDisableTOTP turns two-factor authentication off. A stolen access
+// token alone is not enough: the request has to carry the password and a
+// code or a recovery code.
+func (cfg *apiConfig) handlerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	dbUser, err := qtx.GetUserByID(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	// Throttled like logins, so that a stolen access token cannot be used to
+	// guess the password.
+	attempt, wait, err := cfg.startLoginAttempt(r, dbUser.Email)
+	if err != nil {
+		log.Printf("Unable to start login attempt: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if wait > 0 {
+		respondTooManyLoginAttempts(w, wait)
+		return
+	}
+
+	if err := auth.CheckPasswordHash(params.Password, dbUser.HashedPassword); err != nil {
+		cfg.failLoginAttempt(r, attempt, &dbUser)
+		respondWithError(w, http.StatusForbidden, "Incorrect password or code")
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(r, qtx, userId, params.Code, params.RecoveryCode)
+	if err != nil {
+		log.Printf("Unable to check second factor: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !ok {
+		cfg.failLoginAttempt(r, attempt, &dbUser)
+		respondWithError(w, http.StatusForbidden, "Incorrect password or code")
+		return
+	}
+
+	if err := cfg.passLoginAttempt(r, attempt); err != nil {
+		log.Printf("Unable to pass login attempt: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := qtx.DeleteTOTPCredential(r.Context(), userId); err != nil {
+		log.Printf("Unable to delete TOTP credential: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userId); err != nil {
+		log.Printf("Unable to delete recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := recordSecurityEvent(r, qtx, userId, securityEventTwoFactorDisabled, ""); err != nil {
+		log.Printf("Unable to record security event: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit disabling two-factor authentication: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerLoginTwoFactor completes a login started with a password by
+// exchanging the challenge token for a session. Every challenge allows a
+// few attempts before another login with the password is needed.
+func (cfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if params.Code == "" && params.RecoveryCode == "" {
+		respondWithError(w, http.StatusBadRequest, "Code or recovery code is required")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	challenge, err := qtx.GetLoginChallengeForUpdate(r.Context(), auth.HashToken(params.ChallengeToken))
+	if err != nil || !auth.CheckTokenHash(params.ChallengeToken, challenge.TokenHash) {
+		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	if challenge.UsedAt.Valid || !challenge.ExpiresAt.After(cfg.now()) || challenge.Attempts >= maxLoginChallengeAttempts {
+		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	dbUser, err := qtx.GetUserByID(r.Context(), challenge.UserID)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	// Wrong codes count as failed logins too, so that fetching new
+	// challenges with the password does not allow guessing codes quickly.
+	attempt, wait, err := cfg.startLoginAttempt(r, dbUser.Email)
+	if err != nil {
+		log.Printf("Unable to start login attempt: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if wait > 0 {
+		respondTooManyLoginAttempts(w, wait)
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(r, qtx, challenge.UserID, params.Code, params.RecoveryCode)
+	if err != nil {
+		log.Printf("Unable to check second factor: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !ok {
+		if err := qtx.IncrementLoginChallengeAttempts(r.Context(), challenge.TokenHash); err != nil {
+			log.Printf("Unable to record login challenge attempt: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("Unable to commit login challenge attempt: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		cfg.failLoginAttempt(r, attempt, &dbUser)
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	if restriction := accountRestriction(dbUser); restriction != "" {
+		respondWithError(w, http.StatusForbidden, restriction)
+		return
+	}
+
+	if err := qtx.UseLoginChallenge(r.Context(), challenge.TokenHash); err != nil {
+		log.Printf("Unable to use login challenge: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit login challenge: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if err := cfg.passLoginAttempt(r, attempt); err != nil {
+		log.Printf("Unable to pass login attempt: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	cfg.finishLogin(w, r, dbUser, challenge.DeviceName)
+}
+
+// checkSecondFactor reports whether recoveryCode is an unused recovery code
+// of the user or, without one, whether code is a current TOTP code, and uses
+// it up so it cannot be presented again. qtx has to belong to a transaction
+// for the TOTP credential to stay locked until the step is stored.
+func (cfg *apiConfig) checkSecondFactor(r *http.Request, qtx *database.Queries, userId uuid.UUID, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		rows, err := qtx.UseRecoveryCode(r.Context(), database.UseRecoveryCodeParams{
+			UserID:   userId,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+		})
+		if err != nil || rows == 0 {
+			return false, err
+		}
+		return true, recordSecurityEvent(r, qtx, userId, securityEventRecoveryCodeUsed, "")
+	}
+
+	credential, err := qtx.GetTOTPCredentialForUpdate(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !credential.ConfirmedAt.Valid {
+		return false, nil
+	}
+
+	step, ok := totp.Validate(credential.Secret, code, cfg.now(), credential.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+	return true, qtx.UseTOTPStep(r.Context(), database.UseTOTPStepParams{
+		UserID:       userId,
+		LastUsedStep: step,
+	})
+}
@@ -1,18 +1,29 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/mail"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"example.com/chirpy/internal/auth"
 	"example.com/chirpy/internal/database"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const accessTokenExpiresIn time.Duration = time.Hour
 const refreshTokenExpiresIn time.Duration = 60 * 24 * time.Hour
+const minPasswordLength int = 8
+const minHandleLength int = 3
+const maxHandleLength int = 30
+const maxDisplayNameLength int = 50
 
 type user struct {
 	ID          uuid.UUID `json:"id"`
@@ -20,6 +31,89 @@ type user struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 	Email       string    `json:"email"`
 	IsChirpyRed bool      `json:"is_chirpy_red"`
+	Role        string    `json:"role"`
+
+	Handle          string            `json:"handle"`
+	DisplayName     string            `json:"display_name"`
+	IsEmailVerified bool              `json:"is_email_verified"`
+	AvatarURLs      map[string]string `json:"avatar_urls"`
+	BannerURLs      map[string]string `json:"banner_urls"`
+
+	AllowDirectMessages bool `json:"allow_direct_messages"`
+}
+
+// profile is the public view of a user.
+type profile struct {
+	ID          uuid.UUID         `json:"id"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Handle      string            `json:"handle"`
+	DisplayName string            `json:"display_name"`
+	IsChirpyRed bool              `json:"is_chirpy_red"`
+	AvatarURLs  map[string]string `json:"avatar_urls"`
+	BannerURLs  map[string]string `json:"banner_urls"`
+}
+
+func (cfg *apiConfig) userFromDatabase(dbUser database.User) user {
+	return user{
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		UpdatedAt:   dbUser.UpdatedAt,
+		Email:       dbUser.Email,
+		IsChirpyRed: dbUser.IsChirpyRed,
+		Role:        dbUser.Role,
+
+		Handle:          dbUser.Handle.String,
+		DisplayName:     dbUser.DisplayName,
+		IsEmailVerified: dbUser.EmailVerifiedAt.Valid,
+		AvatarURLs:      cfg.imageURLs(dbUser.AvatarKey, avatarSpec),
+		BannerURLs:      cfg.imageURLs(dbUser.BannerKey, bannerSpec),
+
+		AllowDirectMessages: dbUser.AllowDirectMessages,
+	}
+}
+
+func (cfg *apiConfig) profileFromDatabase(dbUser database.User) profile {
+	return profile{
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		Handle:      dbUser.Handle.String,
+		DisplayName: dbUser.DisplayName,
+		IsChirpyRed: dbUser.IsChirpyRed,
+		AvatarURLs:  cfg.imageURLs(dbUser.AvatarKey, avatarSpec),
+		BannerURLs:  cfg.imageURLs(dbUser.BannerKey, bannerSpec),
+	}
+}
+
+func (cfg *apiConfig) handlerGetProfile(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, cfg.profileFromDatabase(dbUser))
+}
+
+// handlerGetCurrentUser returns the caller's own account, including private
+// fields such as the email address.
+func (cfg *apiConfig) handlerGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	userId := principalFromContext(r.Context()).UserID
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, cfg.userFromDatabase(dbUser))
 }
 
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
@@ -34,8 +128,16 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 	decoder := json.NewDecoder(r.Body)
 	var params parameters
 	if err := decoder.Decode(&params); err != nil {
-		log.Printf("Error parsing JSON parameters: %s", err)
-		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if err := validateEmail(params.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validatePassword(params.Password); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -50,78 +152,287 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		HashedPassword: hashedPassword,
 		Email:          params.Email,
 	})
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "Email is already in use")
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating user: %s", err)
 		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
+	if err := cfg.sendVerificationEmail(r.Context(), newUser); err != nil {
+		log.Printf("Unable to send verification email: %s", err)
+	}
+
 	respondWithJson(w, http.StatusCreated, response{
-		user: user{
-			ID:          newUser.ID,
-			CreatedAt:   newUser.CreatedAt,
-			UpdatedAt:   newUser.UpdatedAt,
-			Email:       newUser.Email,
-			IsChirpyRed: newUser.IsChirpyRed,
-		},
+		user: cfg.userFromDatabase(newUser),
 	})
 }
 
+// handlerUpdateUser serves the legacy PUT /api/users. It takes the same
+// body as PATCH /api/users/me and is subject to the same checks.
 func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
+	cfg.handlerPatchUser(w, r)
+}
+
+func (cfg *apiConfig) handlerPatchUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		Handle          *string `json:"handle"`
+		DisplayName     *string `json:"display_name"`
+		// AllowDirectMessages is whether others may start conversations
+		// with the user.
+		AllowDirectMessages *bool `json:"allow_direct_messages"`
 	}
 	type response struct {
 		user
+		RefreshToken string `json:"refresh_token,omitempty"`
 	}
 
-	bearer, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Unable to fetch bearer token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
-		return
-	}
+	userId := principalFromContext(r.Context()).UserID
 
 	decoder := json.NewDecoder(r.Body)
 	var params parameters
 	if err := decoder.Decode(&params); err != nil {
-		log.Printf("Error parsing JSON parameters: %s", err)
-		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
 		return
 	}
 
-	userId, err := auth.ValidateJWT(bearer, cfg.jwtSecret)
+	if params.Email == nil && params.Password == nil && params.Handle == nil && params.DisplayName == nil && params.AllowDirectMessages == nil {
+		respondWithError(w, http.StatusBadRequest, "Nothing to update")
+		return
+	}
+	if params.Email != nil {
+		if err := validateEmail(*params.Email); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if params.Password != nil {
+		if err := validatePassword(*params.Password); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if params.Handle != nil {
+		normalized, err := normalizeHandle(*params.Handle)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.Handle = &normalized
+	}
+	if params.DisplayName != nil {
+		normalized, err := normalizeDisplayName(*params.DisplayName)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params.DisplayName = &normalized
+	}
+	credentialsChanged := params.Email != nil || params.Password != nil
+	if credentialsChanged && params.CurrentPassword == "" {
+		respondWithError(w, http.StatusBadRequest, "Current password is required")
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
 	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
 		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	// The current password is throttled like logins, so that a stolen
+	// access token cannot be used to guess it.
+	if credentialsChanged {
+		attempt, wait, err := cfg.startLoginAttempt(r, dbUser.Email)
+		if err != nil {
+			log.Printf("Unable to start login attempt: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if wait > 0 {
+			respondTooManyLoginAttempts(w, wait)
+			return
+		}
+		if err := auth.CheckPasswordHash(params.CurrentPassword, dbUser.HashedPassword); err != nil {
+			cfg.failLoginAttempt(r, attempt, &dbUser)
+			respondWithError(w, http.StatusUnauthorized, "Incorrect password")
+			return
+		}
+		if err := cfg.passLoginAttempt(r, attempt); err != nil {
+			log.Printf("Unable to pass login attempt: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
 	if err != nil {
-		log.Printf("Unable to hash password: %s", err)
+		log.Printf("Unable to begin transaction: %s", err)
 		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
 
-	dbUser, err := cfg.dbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             userId,
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-	})
-	if err != nil {
-		log.Printf("Unable to update user: %s", err)
+	if params.Handle != nil || params.DisplayName != nil {
+		handle := dbUser.Handle
+		if params.Handle != nil {
+			handle = sql.NullString{String: *params.Handle, Valid: true}
+		}
+		displayName := dbUser.DisplayName
+		if params.DisplayName != nil {
+			displayName = *params.DisplayName
+		}
+
+		dbUser, err = qtx.UpdateUserProfile(r.Context(), database.UpdateUserProfileParams{
+			Handle:      handle,
+			DisplayName: displayName,
+			ID:          userId,
+		})
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Handle is already taken")
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to update profile: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	if params.AllowDirectMessages != nil {
+		dbUser, err = qtx.UpdateUserAllowDirectMessages(r.Context(), database.UpdateUserAllowDirectMessagesParams{
+			AllowDirectMessages: *params.AllowDirectMessages,
+			ID:                  userId,
+		})
+		if err != nil {
+			log.Printf("Unable to update direct message setting: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	emailChanged := false
+	if params.Email != nil && *params.Email != dbUser.Email {
+		dbUser, err = qtx.UpdateUserEmail(r.Context(), database.UpdateUserEmailParams{
+			Email: *params.Email,
+			ID:    userId,
+		})
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Email is already in use")
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to update email: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		emailChanged = true
+	}
+
+	// A password change signs out every other device: all refresh tokens are
+	// revoked and the caller gets a fresh one in the response.
+	var refreshToken string
+	if params.Password != nil {
+		hashedPassword, err := auth.HashPassword(*params.Password)
+		if err != nil {
+			log.Printf("Unable to hash password: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		dbUser, err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			HashedPassword: hashedPassword,
+			ID:             userId,
+		})
+		if err != nil {
+			log.Printf("Unable to update password: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		if err := revokeAllTokens(r.Context(), qtx, userId); err != nil {
+			log.Printf("Unable to revoke tokens: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		refreshToken, err = issueRefreshToken(r, qtx, userId, uuid.New(), "")
+		if err != nil {
+			log.Printf("Unable to create refresh token: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Unable to commit user update: %s", err)
 		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
+	if emailChanged {
+		if err := cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+			log.Printf("Unable to send verification email: %s", err)
+		}
+	}
+
 	respondWithJson(w, http.StatusOK, response{
-		user: user{
-			ID:          dbUser.ID,
-			CreatedAt:   dbUser.CreatedAt,
-			UpdatedAt:   dbUser.UpdatedAt,
-			Email:       dbUser.Email,
-			IsChirpyRed: dbUser.IsChirpyRed,
-		},
+		user:         cfg.userFromDatabase(dbUser),
+		RefreshToken: refreshToken,
 	})
 }
+
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("Invalid email address")
+	}
+	return nil
+}
+
+// normalizeHandle lowercases handle and strips a leading "@". Handles are
+// 3 to 30 characters of ASCII letters, digits and underscores.
+func normalizeHandle(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+	if len(handle) < minHandleLength || len(handle) > maxHandleLength {
+		return "", fmt.Errorf("Handle must be between %d and %d characters", minHandleLength, maxHandleLength)
+	}
+	for _, c := range handle {
+		if !isHandleChar(c) {
+			return "", errors.New("Handle may only contain letters, digits and underscores")
+		}
+	}
+	return handle, nil
+}
+
+func isHandleChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+func normalizeDisplayName(displayName string) (string, error) {
+	displayName = strings.TrimSpace(displayName)
+	if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		return "", fmt.Errorf("Display name must be at most %d characters", maxDisplayNameLength)
+	}
+	return displayName, nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return errors.New("Password is too short")
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
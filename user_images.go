@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"example.com/chirpy/internal/database"
+	"example.com/chirpy/internal/imaging"
+	"github.com/google/uuid"
+)
+
+const maxImageUploadBytes int64 = 10 << 20
+
+var avatarSpec = imaging.Spec{
+	MinWidth:  100,
+	MinHeight: 100,
+	MaxWidth:  4096,
+	MaxHeight: 4096,
+	Format:    imaging.FormatPNG,
+	Variants: []imaging.Variant{
+		{Name: "large", Width: 400, Height: 400},
+		{Name: "medium", Width: 200, Height: 200},
+		{Name: "small", Width: 48, Height: 48},
+	},
+}
+
+var bannerSpec = imaging.Spec{
+	MinWidth:  600,
+	MinHeight: 200,
+	MaxWidth:  6000,
+	MaxHeight: 4000,
+	Format:    imaging.FormatJPEG,
+	Variants: []imaging.Variant{
+		{Name: "large", Width: 1500, Height: 500},
+		{Name: "small", Width: 600, Height: 200},
+	},
+}
+
+func variantKey(prefix string, spec imaging.Spec, variant imaging.Variant) string {
+	return prefix + "/" + variant.Name + "." + spec.Format.Extension()
+}
+
+// imageURLs maps variant names to URLs for an image stored under prefix.
+func (cfg *apiConfig) imageURLs(prefix sql.NullString, spec imaging.Spec) map[string]string {
+	if !prefix.Valid {
+		return nil
+	}
+	urls := make(map[string]string, len(spec.Variants))
+	for _, variant := range spec.Variants {
+		urls[variant.Name] = cfg.media.URL(variantKey(prefix.String, spec, variant))
+	}
+	return urls
+}
+
+func (cfg *apiConfig) handlerUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	cfg.uploadUserImage(w, r, "avatars", avatarSpec,
+		func(user database.User) sql.NullString { return user.AvatarKey },
+		func(ctx context.Context, userId uuid.UUID, key sql.NullString) (database.User, error) {
+			return cfg.dbQueries.UpdateUserAvatar(ctx, database.UpdateUserAvatarParams{AvatarKey: key, ID: userId})
+		},
+	)
+}
+
+func (cfg *apiConfig) handlerUploadBanner(w http.ResponseWriter, r *http.Request) {
+	cfg.uploadUserImage(w, r, "banners", bannerSpec,
+		func(user database.User) sql.NullString { return user.BannerKey },
+		func(ctx context.Context, userId uuid.UUID, key sql.NullString) (database.User, error) {
+			return cfg.dbQueries.UpdateUserBanner(ctx, database.UpdateUserBannerParams{BannerKey: key, ID: userId})
+		},
+	)
+}
+
+// uploadUserImage processes the raw image in the request body, stores every
+// variant under a fresh prefix and then swaps the user's key over, deleting
+// the previous variants.
+func (cfg *apiConfig) uploadUserImage(
+	w http.ResponseWriter,
+	r *http.Request,
+	folder string,
+	spec imaging.Spec,
+	currentKey func(database.User) sql.NullString,
+	updateKey func(context.Context, uuid.UUID, sql.NullString) (database.User, error),
+) {
+	type response struct {
+		user
+	}
+
+	userId := principalFromContext(r.Context()).UserID
+
+	outputs, err := imaging.Process(http.MaxBytesReader(w, r.Body, maxImageUploadBytes), spec)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Image is too large")
+		return
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		respondWithError(w, http.StatusUnsupportedMediaType, "Image must be PNG, JPEG or WebP")
+		return
+	case err != nil:
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userId)
+	if err != nil {
+		log.Printf("Unable to fetch user: %s", err)
+		respondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	oldKey := currentKey(dbUser)
+
+	prefix := folder + "/" + userId.String() + "/" + uuid.NewString()
+	for _, output := range outputs {
+		if err := cfg.media.Put(r.Context(), variantKey(prefix, spec, output.Variant), bytes.NewReader(output.Data)); err != nil {
+			log.Printf("Unable to store image: %s", err)
+			respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	dbUser, err = updateKey(r.Context(), userId, sql.NullString{String: prefix, Valid: true})
+	if err != nil {
+		log.Printf("Unable to update image key: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if oldKey.Valid {
+		for _, variant := range spec.Variants {
+			if err := cfg.media.Delete(r.Context(), variantKey(oldKey.String, spec, variant)); err != nil {
+				log.Printf("Unable to delete old image: %s", err)
+			}
+		}
+	}
+
+	respondWithJson(w, http.StatusOK, response{
+		user: cfg.userFromDatabase(dbUser),
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/chirpy/internal/database"
+)
+
+const defaultSearchLimit int = 20
+const maxSearchLimit int = 50
+const autocompleteLimit int = 10
+
+func (cfg *apiConfig) handlerSearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing search query")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	dbUsers, err := cfg.dbQueries.SearchUsers(r.Context(), database.SearchUsersParams{
+		Pattern:    escapeLike(strings.TrimPrefix(query, "@")),
+		Query:      query,
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		log.Printf("Unable to search users: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	profiles := []profile{}
+	for _, dbUser := range dbUsers {
+		profiles = append(profiles, cfg.profileFromDatabase(dbUser))
+	}
+	respondWithJson(w, http.StatusOK, profiles)
+}
+
+func (cfg *apiConfig) handlerAutocompleteHandles(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("prefix"), "@"))
+	for _, c := range prefix {
+		if !isHandleChar(c) {
+			respondWithJson(w, http.StatusOK, []profile{})
+			return
+		}
+	}
+	if prefix == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing prefix")
+		return
+	}
+
+	// Handles only contain ASCII below 0x7f, so every handle starting with
+	// prefix sorts between prefix and prefix+"\x7f". The range lets Postgres
+	// use the text_pattern_ops index.
+	dbUsers, err := cfg.dbQueries.AutocompleteHandles(r.Context(), database.AutocompleteHandlesParams{
+		LowerBound: prefix,
+		UpperBound: prefix + "\x7f",
+		MaxResults: int32(autocompleteLimit),
+	})
+	if err != nil {
+		log.Printf("Unable to autocomplete handles: %s", err)
+		respondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	profiles := []profile{}
+	for _, dbUser := range dbUsers {
+		profiles = append(profiles, cfg.profileFromDatabase(dbUser))
+	}
+	respondWithJson(w, http.StatusOK, profiles)
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"example.com/chirpy/internal/auth"
+	"example.com/chirpy/internal/events"
 	"github.com/google/uuid"
 )
 
@@ -61,5 +62,10 @@ func (cfg *apiConfig) handlerEnableChirpyRed(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	cfg.publishEvent(r.Context(), events.UserUpgraded, struct {
+		UserID      uuid.UUID `json:"user_id"`
+		IsChirpyRed bool      `json:"is_chirpy_red"`
+	}{userId, true}, []uuid.UUID{userId})
+
 	w.WriteHeader(http.StatusNoContent)
 }
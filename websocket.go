@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/chirpy/internal/stream"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/google/uuid"
+)
+
+const maxWebSocketsPerUser int = 5
+const wsWriteTimeout time.Duration = 10 * time.Second
+const wsPingInterval time.Duration = 30 * time.Second
+
+// Channels a WebSocket client can subscribe to, and the stream events each
+// one carries.
+var wsChannels = map[string]string{
+	"notifications": streamEventNotification,
+	"messages":      streamEventMessage,
+	"chirps":        streamEventChirp,
+	"account":       streamEventUserUpgraded,
+}
+
+// wsClientMessage is a frame sent by the client. Type is one of auth (with
+// a fresh access token), subscribe and unsubscribe (with channel) or ping.
+type wsClientMessage struct {
+	Type    string `json:"type"`
+	Token   string `json:"token,omitempty"`
+	Channel string `json:"channel,omitempty"`
+}
+
+// wsServerMessage is a frame sent by the server. Type is one of ready (once
+// connected and after every auth frame), subscribed, unsubscribed, event, pong or
+// error.
+type wsServerMessage struct {
+	Type      string          `json:"type"`
+	Channel   string          `json:"channel,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	UserID    *uuid.UUID      `json:"user_id,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// wsConnections counts the open WebSocket connections of each user.
+type wsConnections struct {
+	mu     sync.Mutex
+	counts map[uuid.UUID]int
+}
+
+func newWSConnections() *wsConnections {
+	return &wsConnections{counts: map[uuid.UUID]int{}}
+}
+
+// acquire registers a connection for userId unless they are at the limit.
+func (c *wsConnections) acquire(userId uuid.UUID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts[userId] >= maxWebSocketsPerUser {
+		return false
+	}
+	c.counts[userId]++
+	return true
+}
+
+func (c *wsConnections) release(userId uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[userId]--
+	if c.counts[userId] <= 0 {
+		delete(c.counts, userId)
+	}
+}
+
+// wsProtocol is the subprotocol of the WebSocket gateway. Since browsers
+// cannot set headers on the handshake, clients may offer their access token
+// as another subprotocol, wsBearerProtocolPrefix followed by the token,
+// alongside wsProtocol.
+const wsProtocol string = "chirpy"
+const wsBearerProtocolPrefix string = "bearer."
+
+// wsBearerFromProtocol passes a handshake with an access token offered as a
+// subprotocol on to next as if the token was sent in the Authorization
+// header.
+func wsBearerFromProtocol(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := wsProtocolToken(r.Header); token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wsProtocolToken returns the access token offered as a subprotocol, or ""
+// if there is none.
+func wsProtocolToken(header http.Header) string {
+	for _, value := range header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), wsBearerProtocolPrefix); ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// handlerWebSocket upgrades to a WebSocket that pushes notifications, direct
+// messages, new chirps and account changes for the channels the client
+// subscribes to. The socket is closed when the access token it was opened
+// with expires unless the client sends a fresh one in an auth frame before
+// then.
+func (cfg *apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+	caller := principalFromContext(r.Context())
+	userId := caller.UserID
+	expiresAt := caller.ExpiresAt
+
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{Subprotocols: []string{wsProtocol}})
+	if err != nil {
+		log.Printf("Unable to accept WebSocket: %s", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	if !cfg.websockets.acquire(userId) {
+		conn.Close(websocket.StatusTryAgainLater, "Too many connections")
+		return
+	}
+	defer cfg.websockets.release(userId)
+
+	var mu sync.Mutex
+	subscribed := map[string]bool{}
+	sub, _, _ := cfg.stream.Subscribe(0, func(event stream.Event) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if !subscribed[event.Type] {
+			return false
+		}
+		return len(event.Audience) == 0 || slices.Contains(event.Audience, userId)
+	})
+	defer cfg.stream.Unsubscribe(sub)
+
+	write := func(msg wsServerMessage) error {
+		writeCtx, cancelWrite := context.WithTimeout(ctx, wsWriteTimeout)
+		defer cancelWrite()
+		return wsjson.Write(writeCtx, conn, msg)
+	}
+
+	incoming := make(chan wsClientMessage)
+	go func() {
+		defer cancel()
+		for {
+			var msg wsClientMessage
+			if err := wsjson.Read(ctx, conn, &msg); err != nil {
+				return
+			}
+			select {
+			case incoming <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := write(wsServerMessage{Type: "ready", UserID: &userId, ExpiresAt: &expiresAt}); err != nil {
+		return
+	}
+
+	expiry := time.NewTimer(time.Until(expiresAt))
+	defer expiry.Stop()
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		var reply wsServerMessage
+		select {
+		case <-ctx.Done():
+			return
+
+		case msg := <-incoming:
+			switch msg.Type {
+			case "auth":
+				tokenCaller, err := cfg.authenticateToken(r, msg.Token)
+				if err != nil || !tokenCaller.firstParty() {
+					reply = wsServerMessage{Type: "error", Error: "Invalid token"}
+					break
+				}
+				if tokenCaller.UserID != userId {
+					conn.Close(websocket.StatusPolicyViolation, "Token belongs to another user")
+					return
+				}
+				expiresAt = tokenCaller.ExpiresAt
+				expiry.Reset(time.Until(expiresAt))
+				reply = wsServerMessage{Type: "ready", UserID: &userId, ExpiresAt: &expiresAt}
+			case "subscribe", "unsubscribe":
+				eventType, ok := wsChannels[msg.Channel]
+				if !ok {
+					reply = wsServerMessage{Type: "error", Channel: msg.Channel, Error: "Unknown channel"}
+					break
+				}
+				mu.Lock()
+				subscribed[eventType] = msg.Type == "subscribe"
+				mu.Unlock()
+				reply = wsServerMessage{Type: msg.Type + "d", Channel: msg.Channel}
+			case "ping":
+				reply = wsServerMessage{Type: "pong"}
+			default:
+				reply = wsServerMessage{Type: "error", Error: "Unknown message type"}
+			}
+
+		case event, ok := <-sub.Events():
+			if !ok {
+				conn.Close(websocket.StatusTryAgainLater, "Connection fell behind")
+				return
+			}
+			for channel, eventType := range wsChannels {
+				if eventType == event.Type {
+					reply = wsServerMessage{Type: "event", Channel: channel, Data: event.Data}
+				}
+			}
+
+		case <-ping.C:
+			pingCtx, cancelPing := context.WithTimeout(ctx, wsWriteTimeout)
+			err := conn.Ping(pingCtx)
+			cancelPing()
+			if err != nil {
+				return
+			}
+			continue
+
+		case <-expiry.C:
+			conn.Close(websocket.StatusPolicyViolation, "Access token expired")
+			return
+		}
+
+		if err := write(reply); err != nil {
+			return
+		}
+	}
+}